@@ -0,0 +1,345 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fogleman/primitive/internal/logger"
+	"github.com/fogleman/primitive/primitive"
+)
+
+type intList []int
+
+func (l *intList) String() string {
+	s := make([]string, len(*l))
+	for i, x := range *l {
+		s[i] = strconv.Itoa(x)
+	}
+	return strings.Join(s, ",")
+}
+
+func (l *intList) Set(value string) error {
+	*l = nil
+	for _, field := range strings.Split(value, ",") {
+		n, err := strconv.ParseInt(strings.TrimSpace(field), 0, 0)
+		if err != nil {
+			return err
+		}
+		*l = append(*l, int(n))
+	}
+	return nil
+}
+
+type batchJob struct {
+	Name   string
+	Input  string
+	Output string
+	Count  int
+	Mode   int
+	Alpha  int
+}
+
+// batchResult is the manifest entry of a job. Score is nil for an output
+// that was skipped with no earlier entry to take the score from.
+type batchResult struct {
+	Score       *float64 `json:"score,omitempty"`
+	Input       string   `json:"input"`
+	Output      string   `json:"output"`
+	Error       string   `json:"error,omitempty"`
+	Count       int      `json:"count"`
+	Mode        int      `json:"mode"`
+	Alpha       int      `json:"alpha"`
+	Elapsed     float64  `json:"elapsed"`
+	Evaluations int      `json:"evaluations"`
+	Skipped     bool     `json:"skipped,omitempty"`
+}
+
+type batchManifest struct {
+	Results []batchResult `json:"results"`
+}
+
+type batchOptions struct {
+	Background string
+	InputSize  int
+	OutputSize int
+	Workers    int
+	Repeat     int
+	Nth        int
+	Native     bool
+}
+
+var batchExtensions = []string{".jpg", ".jpeg", ".png"}
+
+func doBatch(ctx context.Context, args []string) error {
+	var (
+		inDir, outDir string
+		manifestPath  string
+		name          string
+		counts        = intList{100}
+		modes         = intList{1}
+		alphas        = intList{128}
+		parallel      int
+		opts          batchOptions
+		v, vv         bool
+	)
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	fs.StringVar(&inDir, "i", "", "input directory")
+	fs.StringVar(&outDir, "o", "", "output directory")
+	fs.StringVar(&manifestPath, "manifest", "", "manifest path (default: manifest.json in the output directory)")
+	fs.StringVar(&name, "name", "%[1]s.%[2]d.%[3]d.%[4]d.png", "printf-style output file name; the arguments are the image name, count, alpha and mode")
+	fs.Var(&counts, "n", "comma separated numbers of primitives")
+	fs.Var(&modes, "m", "comma separated modes")
+	fs.Var(&alphas, "a", "comma separated alpha values")
+	fs.IntVar(&parallel, "p", 2, "number of images processed at once")
+	fs.StringVar(&opts.Background, "bg", "", "background color (hex)")
+	fs.IntVar(&opts.InputSize, "r", 256, "resize large input images to this size")
+	fs.IntVar(&opts.OutputSize, "s", 1024, "output image size")
+	fs.IntVar(&opts.Workers, "j", 0, "number of parallel workers shared by all images (default uses all cores)")
+	fs.IntVar(&opts.Repeat, "rep", 0, "add N extra shapes per iteration with reduced search")
+	fs.IntVar(&opts.Nth, "nth", 1, "save every Nth frame (put \"%%d\" in the name)")
+	fs.BoolVar(&opts.Native, "native", false, "render raster output with the scanline rasterizer used for scoring")
+	fs.BoolVar(&v, "v", false, "verbose")
+	fs.BoolVar(&vv, "vv", false, "very verbose")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var err error
+	if inDir == "" {
+		err = errors.Join(err, errors.New("ERROR: input argument required"))
+	}
+	if outDir == "" {
+		err = errors.Join(err, errors.New("ERROR: output argument required"))
+	}
+	for _, n := range counts {
+		if n < 1 {
+			err = errors.Join(err, errors.New("ERROR: number argument must be > 0"))
+		}
+	}
+	if slices.Contains(modes, int(primitive.ShapeTypeGlyph)) || slices.Contains(modes, int(primitive.ShapeTypeStamp)) {
+		err = errors.Join(err, errors.New("ERROR: glyph and stamp modes are not supported by batch"))
+	}
+	if _, nameErr := batchName(name, batchJob{Name: "name", Input: "", Output: "", Count: 1, Mode: 1, Alpha: 1}); nameErr != nil {
+		err = errors.Join(err, fmt.Errorf("ERROR: %w", nameErr))
+	}
+	if err != nil {
+		return err
+	}
+
+	logLevel := slog.LevelWarn
+	if v {
+		logLevel = slog.LevelInfo
+	}
+	if vv {
+		logLevel = slog.LevelDebug
+	}
+	logger.SetupLogger(os.Stderr, logLevel)
+
+	if opts.Workers < 1 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if manifestPath == "" {
+		manifestPath = filepath.Join(outDir, "manifest.json")
+	}
+
+	jobs, err := batchJobs(inDir, outDir, name, counts, modes, alphas)
+	if err != nil {
+		return err
+	}
+	previous := make(map[string]batchResult)
+	if manifest, err := loadManifest(manifestPath); err == nil {
+		for _, result := range manifest.Results {
+			previous[result.Output] = result
+		}
+	}
+
+	limiter := primitive.NewLimiter(opts.Workers)
+	// results holds a result for each job, and finished which of them ran
+	results := make([]batchResult, len(jobs))
+	finished := make([]bool, len(jobs))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan int)
+	errs := make([]error, len(jobs))
+	for range max(parallel, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				job := jobs[i]
+				result, err := runBatchJob(ctx, job, opts, limiter, previous)
+				if err != nil {
+					slog.ErrorContext(ctx, "failed", slog.String("output", job.Output), slog.String("error", err.Error()))
+					result.Error = err.Error()
+					errs[i] = fmt.Errorf("%s: %w", job.Output, err)
+				}
+				mu.Lock()
+				results[i], finished[i] = result, true
+				err = saveManifest(manifestPath, results, finished)
+				mu.Unlock()
+				if err != nil {
+					slog.ErrorContext(ctx, "writing manifest", slog.String("error", err.Error()))
+				}
+			}
+		}()
+	}
+	for i := range jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	return errors.Join(append(errs, saveManifest(manifestPath, results, finished))...)
+}
+
+// batchName expands the printf-style name with the image name, count,
+// alpha and mode of job, in that order. A "%%d" left for the frame number
+// becomes "%d".
+func batchName(name string, job batchJob) (string, error) {
+	s := fmt.Sprintf(name, job.Name, job.Count, job.Alpha, job.Mode)
+	if strings.Contains(s, "%!") {
+		return "", fmt.Errorf("bad name %q: got %q", name, s)
+	}
+	return s, nil
+}
+
+// batchJobs lists one job per input image and combination of count, mode
+// and alpha, sorted by image name.
+func batchJobs(inDir, outDir, name string, counts, modes, alphas []int) ([]batchJob, error) {
+	entries, err := os.ReadDir(inDir)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []batchJob
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || !slices.Contains(batchExtensions, ext) {
+			continue
+		}
+		base := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		for _, n := range counts {
+			for _, a := range alphas {
+				for _, m := range modes {
+					job := batchJob{
+						Name:   base,
+						Input:  filepath.Join(inDir, entry.Name()),
+						Output: "",
+						Count:  n,
+						Mode:   m,
+						Alpha:  a,
+					}
+					output, err := batchName(name, job)
+					if err != nil {
+						return nil, err
+					}
+					job.Output = filepath.Join(outDir, output)
+					jobs = append(jobs, job)
+				}
+			}
+		}
+	}
+	slices.SortStableFunc(jobs, func(a, b batchJob) int {
+		return cmp.Or(
+			cmp.Compare(a.Name, b.Name),
+			cmp.Compare(a.Count, b.Count),
+			cmp.Compare(a.Mode, b.Mode),
+		)
+	})
+	return jobs, nil
+}
+
+func runBatchJob(ctx context.Context, job batchJob, opts batchOptions, limiter *primitive.Limiter, previous map[string]batchResult) (batchResult, error) {
+	result := batchResult{
+		Input:       job.Input,
+		Output:      job.Output,
+		Error:       "",
+		Count:       job.Count,
+		Mode:        job.Mode,
+		Alpha:       job.Alpha,
+		Score:       nil,
+		Elapsed:     0,
+		Evaluations: 0,
+		Skipped:     false,
+	}
+	final := job.Output
+	if strings.Contains(final, "%") {
+		final = fmt.Sprintf(final, job.Count)
+	}
+	if _, err := os.Stat(final); err == nil {
+		slog.InfoContext(ctx, "skipping", slog.String("output", final))
+		if prev, ok := previous[job.Output]; ok && prev.Error == "" {
+			result = prev
+		}
+		result.Skipped = true
+		return result, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(job.Output), 0o755); err != nil {
+		return result, err
+	}
+
+	input, err := loadInput(ctx, job.Input, opts.InputSize)
+	if err != nil {
+		return result, err
+	}
+	bg, err := backgroundColor(input, opts.Background)
+	if err != nil {
+		return result, err
+	}
+	model := primitive.NewModel(input, bg, opts.OutputSize, opts.Workers)
+	model.Limiter = limiter
+	im := outputImage(model, opts.OutputSize, opts.Native)
+	stage := primitive.Stage{
+		Count:     job.Count,
+		ShapeType: primitive.ShapeType(job.Mode),
+		Alpha:     job.Alpha,
+		AlphaEnd:  0,
+		Repeat:    opts.Repeat,
+		Tiles:     0,
+	}
+	slog.InfoContext(ctx, "processing", slog.String("input", job.Input), slog.String("output", job.Output))
+	err = model.Run(ctx, []primitive.Stage{stage}, func(p primitive.Progress) error {
+		result.Score = &p.Score
+		result.Elapsed = p.Elapsed.Seconds()
+		result.Evaluations += p.Evaluations
+		return saveFrame(ctx, model, job.Output, p, opts.Nth, im)
+	})
+	return result, err
+}
+
+func loadManifest(path string) (*batchManifest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest batchManifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// saveManifest writes the results of the finished jobs, leaving out jobs
+// that have not run yet so they cannot be mistaken for failed ones.
+func saveManifest(path string, results []batchResult, finished []bool) error {
+	manifest := batchManifest{Results: make([]batchResult, 0, len(results))}
+	for i, result := range results {
+		if finished[i] {
+			manifest.Results = append(manifest.Results, result)
+		}
+	}
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return primitive.SaveFile(path, string(b)+"\n")
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fogleman/primitive/primitive"
+)
+
+type benchScaling struct {
+	Workers    int     `json:"workers"`
+	Seconds    float64 `json:"seconds"`
+	NPS        float64 `json:"nps"`
+	Efficiency float64 `json:"efficiency"`
+}
+
+type benchResult struct {
+	Image     string         `json:"image"`
+	Mode      string         `json:"mode"`
+	Scaling   []benchScaling `json:"scaling"`
+	EnergyNPS float64        `json:"energy_nps"`
+	Score     float64        `json:"score"`
+	Shapes    int            `json:"shapes"`
+}
+
+func (r benchResult) key() string {
+	return r.Image + "/" + r.Mode
+}
+
+type benchReport struct {
+	Results []benchResult `json:"results"`
+	Seed    int64         `json:"seed"`
+}
+
+type benchOptions struct {
+	Seed        int64
+	InputSize   int
+	Shapes      int
+	Evaluations int
+}
+
+func doBench(ctx context.Context, args []string) error {
+	var (
+		pattern   string
+		baseline  string
+		save      string
+		tolerance float64
+		scoreTol  float64
+		modes     = intList{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 15, 16}
+		workers   = intList{1, runtime.NumCPU()}
+		opts      benchOptions
+	)
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.StringVar(&pattern, "i", "examples/*.png", "input images (glob pattern)")
+	fs.Var(&modes, "m", "comma separated modes to benchmark")
+	fs.Var(&workers, "j", "comma separated worker counts for the scaling runs")
+	fs.IntVar(&opts.Shapes, "n", 20, "number of shapes to add per run")
+	fs.IntVar(&opts.InputSize, "r", 128, "resize input images to this size")
+	fs.IntVar(&opts.Evaluations, "e", 5000, "number of energy evaluations to time")
+	fs.Int64Var(&opts.Seed, "seed", 1, "random seed")
+	fs.StringVar(&baseline, "baseline", "", "compare against results saved by -save")
+	fs.StringVar(&save, "save", "", "save results as JSON to this path")
+	fs.Float64Var(&tolerance, "tolerance", 0.1, "relative slowdown treated as a regression")
+	fs.Float64Var(&scoreTol, "score-tolerance", 0.01, "relative score increase treated as a regression")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("ERROR: no images match %s", pattern)
+	}
+	if opts.Shapes < 1 || opts.Evaluations < 1 {
+		return errors.New("ERROR: -n and -e must be > 0")
+	}
+
+	report := benchReport{Results: nil, Seed: opts.Seed}
+	for _, path := range paths {
+		for _, m := range modes {
+			result, err := benchImage(ctx, path, primitive.ShapeType(m), workers, opts)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			report.Results = append(report.Results, result)
+		}
+	}
+	printBenchReport(os.Stdout, &report)
+
+	if save != "" {
+		b, err := json.MarshalIndent(&report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := primitive.SaveFile(save, string(b)+"\n"); err != nil {
+			return err
+		}
+	}
+	if baseline != "" {
+		b, err := os.ReadFile(baseline)
+		if err != nil {
+			return err
+		}
+		var base benchReport
+		if err := json.Unmarshal(b, &base); err != nil {
+			return fmt.Errorf("%s: %w", baseline, err)
+		}
+		if n := compareBenchReports(os.Stdout, &base, &report, tolerance, scoreTol); n > 0 {
+			return fmt.Errorf("%d regressions against %s", n, baseline)
+		}
+	}
+	return nil
+}
+
+func benchImage(ctx context.Context, path string, t primitive.ShapeType, workers []int, opts benchOptions) (benchResult, error) {
+	result := benchResult{
+		Image:     filepath.Base(path),
+		Mode:      t.String(),
+		Scaling:   nil,
+		EnergyNPS: 0,
+		Score:     0,
+		Shapes:    opts.Shapes,
+	}
+	input, err := loadInput(ctx, path, opts.InputSize)
+	if err != nil {
+		return result, err
+	}
+	bg := primitive.MakeColor(primitive.AverageImageColor(input))
+
+	// time the energy function alone, on a fresh canvas
+	model := primitive.NewModel(input, bg, opts.InputSize, 1)
+	model.Seed(opts.Seed)
+	worker := model.Workers[0]
+	worker.Init(model.Current, model.Total)
+	states := make([]*primitive.State, opts.Evaluations)
+	for i := range states {
+		states[i] = worker.RandomState(t, 128)
+	}
+	start := time.Now()
+	for _, state := range states {
+		worker.Energy(state.Shape, state.Alpha)
+	}
+	result.EnergyNPS = float64(len(states)) / time.Since(start).Seconds()
+
+	// full runs at each worker count
+	stage := primitive.Stage{Count: opts.Shapes, ShapeType: t, Alpha: 128, AlphaEnd: 0, Repeat: 0, Tiles: 0}
+	var base float64
+	for i, j := range workers {
+		model := primitive.NewModel(input, bg, opts.InputSize, j)
+		model.Seed(opts.Seed)
+		evaluations := 0
+		start := time.Now()
+		err := model.Run(ctx, []primitive.Stage{stage}, func(p primitive.Progress) error {
+			evaluations += p.Evaluations
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+		seconds := time.Since(start).Seconds()
+		nps := float64(evaluations) / seconds
+		if i == 0 {
+			base = nps / float64(j)
+			result.Score = model.Score
+		}
+		result.Scaling = append(result.Scaling, benchScaling{
+			Workers:    j,
+			Seconds:    seconds,
+			NPS:        nps,
+			Efficiency: nps / float64(j) / base,
+		})
+	}
+	return result, nil
+}
+
+func printBenchReport(w io.Writer, report *benchReport) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "image\tmode\tenergy/s\tscore\tscaling (workers: evaluations/s, efficiency)")
+	for _, r := range report.Results {
+		scaling := make([]string, len(r.Scaling))
+		for i, s := range r.Scaling {
+			scaling[i] = fmt.Sprintf("%d: %s, %.0f%%", s.Workers, primitive.NumberString(s.NPS), s.Efficiency*100)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.6f\t%s\n",
+			r.Image, r.Mode, primitive.NumberString(r.EnergyNPS), r.Score, strings.Join(scaling, "  "))
+	}
+	tw.Flush()
+}
+
+// compareBenchReports prints the change of each result against the
+// baseline and returns the number of regressions beyond the tolerances.
+func compareBenchReports(w io.Writer, base, current *benchReport, tolerance, scoreTolerance float64) int {
+	previous := make(map[string]benchResult, len(base.Results))
+	for _, r := range base.Results {
+		previous[r.key()] = r
+	}
+	regressions := 0
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nimage\tmode\tenergy/s\tscore\t")
+	for _, r := range current.Results {
+		b, ok := previous[r.key()]
+		if !ok {
+			continue
+		}
+		speed := r.EnergyNPS/b.EnergyNPS - 1
+		score := r.Score/b.Score - 1
+		var flags []string
+		if speed < -tolerance {
+			flags = append(flags, "SLOWER")
+		}
+		// scores are only comparable for the same seed and shape count
+		if base.Seed == current.Seed && b.Shapes == r.Shapes && score > scoreTolerance {
+			flags = append(flags, "WORSE")
+		}
+		if math.IsNaN(speed) || math.IsNaN(score) {
+			flags = append(flags, "INVALID")
+		}
+		regressions += len(flags)
+		fmt.Fprintf(tw, "%s\t%s\t%+.1f%%\t%+.2f%%\t%s\n",
+			r.Image, r.Mode, speed*100, score*100, strings.Join(flags, " "))
+	}
+	tw.Flush()
+	return regressions
+}
@@ -5,13 +5,14 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"image"
 	"log/slog"
+	"math"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/fogleman/primitive/internal/logger"
 	"github.com/fogleman/primitive/primitive"
@@ -24,12 +25,33 @@ var (
 	Background string
 	Configs    shapeConfigArray
 	Alpha      int
+	AlphaMin   int
+	AlphaMax   int
+	AlphaEnd   int
 	InputSize  int
 	OutputSize int
 	Mode       int
 	Workers    int
 	Nth        int
 	Repeat     int
+	Tiles      int
+	Native     bool
+	LineCap    string
+	LineJoin   string
+	FontPath   string
+	Glyphs     string
+	SpritePath string
+	Order      int
+	Convex     bool
+	Outline    float64
+	Limits     string
+	Anneal     bool
+	Fill       string
+	Palette    string
+	Blend      string
+	Preview    string
+	Progress   string
+	ProgressTo string
 	V, VV      bool
 )
 
@@ -45,10 +67,23 @@ func (i *flagArray) Set(value string) error {
 }
 
 type shapeConfig struct {
-	Count  int
-	Mode   int
-	Alpha  int
-	Repeat int
+	Count    int
+	Mode     int
+	Alpha    int
+	AlphaEnd int
+	Repeat   int
+	Tiles    int
+}
+
+func (c shapeConfig) Stage() primitive.Stage {
+	return primitive.Stage{
+		Count:     c.Count,
+		ShapeType: primitive.ShapeType(c.Mode),
+		Alpha:     c.Alpha,
+		AlphaEnd:  c.AlphaEnd,
+		Repeat:    c.Repeat,
+		Tiles:     c.Tiles,
+	}
 }
 
 type shapeConfigArray []shapeConfig
@@ -62,7 +97,7 @@ func (i *shapeConfigArray) Set(value string) error {
 	if err != nil {
 		return err
 	}
-	*i = append(*i, shapeConfig{int(n), Mode, Alpha, Repeat})
+	*i = append(*i, shapeConfig{int(n), Mode, Alpha, 0, Repeat, Tiles})
 	return nil
 }
 
@@ -71,13 +106,34 @@ func init() {
 	flag.Var(&Outputs, "o", "output image path")
 	flag.Var(&Configs, "n", "number of primitives")
 	flag.StringVar(&Background, "bg", "", "background color (hex)")
-	flag.IntVar(&Alpha, "a", 128, "alpha value")
+	flag.IntVar(&Alpha, "a", 128, "alpha value (0 solves the alpha of each shape)")
+	flag.IntVar(&AlphaMin, "amin", 1, "lowest alpha of shapes when alpha is solved")
+	flag.IntVar(&AlphaMax, "amax", 255, "highest alpha of shapes when alpha is solved")
+	flag.IntVar(&AlphaEnd, "aend", 0, "fade the alpha linearly from -a to this value over the run, overriding the alphas of stages")
 	flag.IntVar(&InputSize, "r", 256, "resize large input images to this size")
 	flag.IntVar(&OutputSize, "s", 1024, "output image size")
-	flag.IntVar(&Mode, "m", 1, "0=combo 1=triangle 2=rect 3=ellipse 4=circle 5=rotatedrect 6=beziers 7=rotatedellipse 8=polygon")
+	flag.IntVar(&Mode, "m", 1, "0=combo 1=triangle 2=rect 3=ellipse 4=circle 5=rotatedrect 6=beziers 7=rotatedellipse 8=polygon 9=cubic 10=blob 11=line 12=polyline 13=glyph 14=stamp 15=regularpolygon 16=star")
 	flag.IntVar(&Workers, "j", 0, "number of parallel workers (default uses all cores)")
 	flag.IntVar(&Nth, "nth", 1, "save every Nth frame (put \"%d\" in path)")
 	flag.IntVar(&Repeat, "rep", 0, "add N extra shapes per iteration with reduced search")
+	flag.IntVar(&Tiles, "tiles", 0, "search an N x N grid of tiles at once, adding up to one shape per tile each iteration")
+	flag.StringVar(&LineCap, "cap", "round", "line cap for line and polyline shapes: round, butt or square")
+	flag.StringVar(&LineJoin, "join", "round", "line join for polyline shapes: round or bevel")
+	flag.StringVar(&FontPath, "font", "", "TrueType font for glyph shapes")
+	flag.StringVar(&Glyphs, "glyphs", "ABCDEFGHIJKLMNOPQRSTUVWXYZ", "characters glyph shapes are drawn from")
+	flag.StringVar(&SpritePath, "sprite", "", "image whose alpha (or darkness, if opaque) is the mask for stamp shapes")
+	flag.IntVar(&Order, "order", 0, "vertices of polygon shapes, or sides or points of regularpolygon and star shapes (default 4, 6 and 5)")
+	flag.BoolVar(&Convex, "convex", false, "keep polygon shapes convex")
+	flag.Float64Var(&Outline, "outline", 0, "draw triangles, polygons and ellipses as outlines of this stroke width instead of filling them")
+	flag.BoolVar(&Anneal, "anneal", false, "shrink spawn and mutation distances as the shapes found get smaller")
+	flag.StringVar(&Fill, "fill", "flat", "paint shapes with a flat color or a linear or radial gradient: flat, linear or radial")
+	flag.StringVar(&Blend, "blend", "normal", "how shapes combine with the image beneath them: normal, multiply, screen, add or difference")
+	flag.StringVar(&Palette, "palette", "", "restrict shape colors to a palette: a file or list of hex colors, or auto:K to extract K colors from the input")
+	flag.StringVar(&Limits, "constraints", "", "JSON file or object of per shape type constraints, e.g. '{\"circle\": {\"min_size\": 40}}'")
+	flag.BoolVar(&Native, "native", false, "render raster output with the scanline rasterizer used for scoring")
+	flag.StringVar(&Preview, "preview", "", "serve a live preview page on this address (e.g. :8080)")
+	flag.StringVar(&Progress, "progress", "text", "progress output format: text or json")
+	flag.StringVar(&ProgressTo, "progress-file", "-", "write json progress to this file (\"-\" for stderr)")
 	flag.BoolVar(&V, "v", false, "verbose")
 	flag.BoolVar(&VV, "vv", false, "very verbose")
 }
@@ -89,6 +145,7 @@ func main() {
 func run() int {
 	ctx := context.Background()
 	if err := doRun(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		if hasExitCode, ok := err.(interface{ ExitCode() int }); ok {
 			return hasExitCode.ExitCode()
 		}
@@ -97,7 +154,22 @@ func run() int {
 	return 0
 }
 
+type command func(ctx context.Context, args []string) error
+
+var commands = map[string]command{
+	"batch":  doBatch,
+	"bench":  doBench,
+	"render": doRender,
+	"report": doReport,
+	"serve":  doServe,
+}
+
 func doRun(ctx context.Context) error {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			return cmd(ctx, os.Args[2:])
+		}
+	}
 	flag.Parse()
 	var err error
 	if Input == "" {
@@ -114,10 +186,90 @@ func doRun(ctx context.Context) error {
 		Configs[0].Alpha = Alpha
 		Configs[0].Repeat = Repeat
 	}
+	for i := range Configs {
+		Configs[i].Tiles = Tiles
+	}
 	for _, config := range Configs {
 		if config.Count < 1 {
 			err = errors.Join(err, errors.New("ERROR: number argument must be > 0"))
 		}
+		if primitive.ShapeType(config.Mode) == primitive.ShapeTypeGlyph && FontPath == "" {
+			err = errors.Join(err, errors.New("ERROR: font argument required for glyph mode"))
+		}
+		if primitive.ShapeType(config.Mode) == primitive.ShapeTypeStamp && SpritePath == "" {
+			err = errors.Join(err, errors.New("ERROR: sprite argument required for stamp mode"))
+		}
+	}
+	if AlphaMin < 1 || AlphaMax > 255 || AlphaMin > AlphaMax {
+		err = errors.Join(err, errors.New("ERROR: amin and amax arguments must satisfy 1 <= amin <= amax <= 255"))
+	}
+	if AlphaEnd != 0 {
+		if AlphaEnd < 1 || AlphaEnd > 255 {
+			err = errors.Join(err, errors.New("ERROR: aend argument must be between 1 and 255"))
+		}
+		if Alpha == 0 {
+			err = errors.Join(err, errors.New("ERROR: aend argument needs a fixed alpha"))
+		}
+		scheduleAlpha(Configs, Alpha, AlphaEnd)
+	}
+	if FontPath != "" && Glyphs == "" {
+		err = errors.Join(err, errors.New("ERROR: glyphs argument must not be empty"))
+	}
+	if Order != 0 && Order < 3 {
+		err = errors.Join(err, errors.New("ERROR: order argument must be at least 3"))
+	}
+	if Tiles < 0 {
+		err = errors.Join(err, errors.New("ERROR: tiles argument must not be negative"))
+	}
+	if Tiles > 1 && Repeat > 0 {
+		err = errors.Join(err, errors.New("ERROR: tiles and rep arguments cannot be combined"))
+	}
+	if Outline < 0 {
+		err = errors.Join(err, errors.New("ERROR: outline argument must not be negative"))
+	}
+	if Progress != "text" && Progress != "json" {
+		err = errors.Join(err, errors.New("ERROR: progress argument must be text or json"))
+	}
+	opts := primitive.DefaultShapeOptions()
+	lineCap, capErr := primitive.ParseLineCap(LineCap)
+	if capErr != nil {
+		err = errors.Join(err, errors.New("ERROR: cap argument must be round, butt or square"))
+	}
+	lineJoin, joinErr := primitive.ParseLineJoin(LineJoin)
+	if joinErr != nil {
+		err = errors.Join(err, errors.New("ERROR: join argument must be round or bevel"))
+	}
+	opts.LineCap, opts.LineJoin = lineCap, lineJoin
+	opts.PolygonOrder, opts.PolygonConvex = Order, Convex
+	opts.Outline = Outline
+	opts.Anneal = Anneal
+	opts.AlphaMin, opts.AlphaMax = AlphaMin, AlphaMax
+	fill, fillErr := primitive.ParseFill(Fill)
+	if fillErr != nil {
+		err = errors.Join(err, errors.New("ERROR: fill argument must be flat, linear or radial"))
+	}
+	opts.Fill = fill
+	blend, blendErr := primitive.ParseBlendMode(Blend)
+	if blendErr != nil {
+		err = errors.Join(err, errors.New("ERROR: blend argument must be normal, multiply, screen, add or difference"))
+	}
+	if blend != primitive.BlendNormal && fill != primitive.FillFlat {
+		err = errors.Join(err, errors.New("ERROR: gradient fills need the normal blend mode"))
+	}
+	opts.Blend = blend
+	paletteSize, autoPalette, paletteErr := parseAutoPalette(Palette)
+	if !autoPalette && Palette != "" {
+		opts.Palette, paletteErr = primitive.LoadPalette(Palette)
+	}
+	if paletteErr != nil {
+		err = errors.Join(err, fmt.Errorf("ERROR: palette argument: %w", paletteErr))
+	}
+	if Limits != "" {
+		constraints, limitsErr := primitive.LoadConstraints(Limits)
+		if limitsErr != nil {
+			err = errors.Join(err, fmt.Errorf("ERROR: constraints argument: %w", limitsErr))
+		}
+		opts.Constraints = constraints
 	}
 	if err != nil {
 		return err
@@ -138,91 +290,239 @@ func doRun(ctx context.Context) error {
 		Workers = runtime.NumCPU()
 	}
 
-	// read input image
-	slog.DebugContext(ctx, "reading input", slog.String("input", Input))
-	input, err := primitive.LoadImage(Input)
+	input, err := loadInput(ctx, Input, InputSize)
 	if err != nil {
 		return err
 	}
-
-	// scale down input image if needed
-	size := uint(InputSize)
-	if size > 0 {
-		input = resize.Thumbnail(size, size, input, resize.Bilinear)
+	size := input.Bounds().Size()
+	if err = primitive.CheckConstraints(opts.Constraints, size.X, size.Y); err != nil {
+		return fmt.Errorf("ERROR: constraints argument: %w", err)
 	}
-
-	// determine background color
-	var bg *primitive.Color
-	if Background == "" {
-		bg = primitive.MakeColor(primitive.AverageImageColor(input))
-	} else {
-		var err error
-		bg, err = primitive.MakeHexColor(Background)
-		if err != nil {
-			return err
+	if autoPalette {
+		opts.Palette = primitive.ExtractPalette(input, paletteSize)
+	}
+	bg, err := backgroundColor(input, Background)
+	if err != nil {
+		return err
+	}
+	if opts.Palette != nil && Background == "" {
+		c := opts.Palette.Nearest(*bg)
+		bg = &c
+	}
+	if FontPath != "" {
+		if opts.Font, err = primitive.LoadFont(FontPath, Glyphs); err != nil {
+			return fmt.Errorf("%s: %w", FontPath, err)
+		}
+	}
+	if SpritePath != "" {
+		if opts.Sprite, err = primitive.LoadSprite(SpritePath); err != nil {
+			return fmt.Errorf("%s: %w", SpritePath, err)
 		}
 	}
 
 	// run algorithm
 	model := primitive.NewModel(input, bg, OutputSize, Workers)
+	model.SetShapeOptions(opts)
 	slog.InfoContext(ctx, "run algorithm",
 		slog.Int("frame", 0),
 		slog.Float64("t", 0.0),
 		slog.Float64("score", model.Score),
 	)
-	start := time.Now()
-	frame := 0
-	for j, config := range Configs {
-		slog.InfoContext(ctx, "", slog.Int("count", config.Count), slog.Int("mode", config.Mode), slog.Int("alpha", config.Alpha), slog.Int("repeat", config.Repeat))
-
-		for i := 0; i < config.Count; i++ {
-			frame++
-
-			// find optimal shape and add it to the model
-			t := time.Now()
-			n := model.Step(ctx, primitive.ShapeType(config.Mode), config.Alpha, config.Repeat)
-			nps := primitive.NumberString(float64(n) / time.Since(t).Seconds())
-			elapsed := time.Since(start).Seconds()
-			slog.InfoContext(ctx, "",
-				slog.Int("frame", frame),
-				slog.Float64("t", elapsed),
-				slog.Float64("score", model.Score),
-				slog.Int("n", n),
-				slog.String("nps", nps),
-			)
-
-			// write output image(s)
-			for _, output := range Outputs {
-				ext := strings.ToLower(filepath.Ext(output))
-				if output == "-" {
-					ext = ".svg"
-				}
-				percent := strings.Contains(output, "%")
-				saveFrames := percent && ext != ".gif"
-				saveFrames = saveFrames && frame%Nth == 0
-				last := j == len(Configs)-1 && i == config.Count-1
-				if saveFrames || last {
-					path := output
-					if percent {
-						path = fmt.Sprintf(output, frame)
-					}
-					slog.InfoContext(ctx, "writing", slog.String("output", path))
-					switch ext {
-					default:
-						return fmt.Errorf("unrecognized file extension: %s", ext)
-					case ".png":
-						return primitive.SavePNG(path, model.Context.Image())
-					case ".jpg", ".jpeg":
-						return primitive.SaveJPG(path, model.Context.Image(), 95)
-					case ".svg":
-						return primitive.SaveFile(path, model.SVG())
-					case ".gif":
-						frames := model.Frames(0.001)
-						return primitive.SaveGIFImageMagick(ctx, path, frames, 50, 250)
-					}
-				}
+	stages := make([]primitive.Stage, len(Configs))
+	for i, config := range Configs {
+		stages[i] = config.Stage()
+	}
+	var pv *preview
+	if Preview != "" {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		pv = newPreview(model)
+		if err = pv.serve(ctx, Preview); err != nil {
+			return err
+		}
+	}
+	var pw *progressWriter
+	if Progress == "json" {
+		out := os.Stderr
+		if ProgressTo != "-" {
+			f, createErr := os.Create(ProgressTo)
+			if createErr != nil {
+				return createErr
 			}
+			defer f.Close()
+			out = f
 		}
+		pw = newProgressWriter(out)
+	}
+	stage := -1
+	err = model.Run(ctx, stages, func(p primitive.Progress) error {
+		if pv != nil {
+			pv.progress(p)
+		}
+		if pw != nil {
+			if stepErr := pw.Step(p); stepErr != nil {
+				return stepErr
+			}
+		}
+		if p.Stage != stage {
+			stage = p.Stage
+			config := Configs[stage]
+			slog.InfoContext(ctx, "", slog.Int("count", config.Count), slog.Int("mode", config.Mode), slog.Int("alpha", config.Alpha), slog.Int("repeat", config.Repeat))
+		}
+		nps := primitive.NumberString(p.NPS())
+		slog.InfoContext(ctx, "",
+			slog.Int("frame", p.Frame),
+			slog.Float64("t", p.Elapsed.Seconds()),
+			slog.Float64("score", p.Score),
+			slog.Int("n", p.Evaluations),
+			slog.String("nps", nps),
+		)
+
+		// write output image(s)
+		for _, output := range Outputs {
+			if saveErr := saveFrame(ctx, model, output, p, Nth, outputImage(model, OutputSize, Native)); saveErr != nil {
+				return saveErr
+			}
+		}
+		return nil
+	})
+	if pw != nil {
+		err = errors.Join(err, pw.Summary(err))
+	}
+	return err
+}
+
+// saveFrame writes output if p is the last frame, or every nth frame when
+// the output path contains a "%d" style verb.
+func saveFrame(ctx context.Context, model *primitive.Model, output string, p primitive.Progress, nth int, im func() (image.Image, error)) error {
+	ext := strings.ToLower(filepath.Ext(output))
+	if output == "-" {
+		ext = ".svg"
+	}
+	percent := strings.Contains(output, "%")
+	saveFrames := percent && ext != ".gif"
+	saveFrames = saveFrames && p.Frame%nth == 0
+	if !saveFrames && !p.Last() {
+		return nil
+	}
+	path := output
+	if percent {
+		path = fmt.Sprintf(output, p.Frame)
+	}
+	slog.InfoContext(ctx, "writing", slog.String("output", path))
+	return saveOutput(ctx, model, path, ext, im)
+}
+
+// loadInput reads the input image, scaling it down to fit a size x size
+// square if size is positive.
+func loadInput(ctx context.Context, path string, size int) (image.Image, error) {
+	slog.DebugContext(ctx, "reading input", slog.String("input", path))
+	input, err := primitive.LoadImage(path)
+	if err != nil {
+		return nil, err
+	}
+	if size > 0 {
+		input = resize.Thumbnail(uint(size), uint(size), input, resize.Bilinear)
+	}
+	return input, nil
+}
+
+// scheduleAlpha sets the alphas of the stages so that over the whole run
+// the alpha moves linearly from start for the first step to end for the
+// last.
+func scheduleAlpha(configs []shapeConfig, start, end int) {
+	total := 0
+	for _, config := range configs {
+		total += config.Count
+	}
+	alpha := func(i int) int {
+		if total < 2 {
+			return start
+		}
+		return int(math.Round(float64(start) + float64(end-start)*float64(i)/float64(total-1)))
+	}
+	first := 0
+	for i := range configs {
+		configs[i].Alpha = alpha(first)
+		configs[i].AlphaEnd = alpha(first + configs[i].Count - 1)
+		first += configs[i].Count
+	}
+}
+
+// parseAutoPalette reads the number of colors from an "auto" or "auto:K"
+// palette argument; auto alone extracts 8. ok is false for other arguments.
+func parseAutoPalette(arg string) (k int, ok bool, err error) {
+	if arg != "auto" && !strings.HasPrefix(arg, "auto:") {
+		return 0, false, nil
+	}
+	if arg == "auto" {
+		return 8, true, nil
+	}
+	k, err = strconv.Atoi(strings.TrimPrefix(arg, "auto:"))
+	if err == nil && (k < 1 || k > 256) {
+		err = errors.New("auto palette size must be between 1 and 256")
+	}
+	return k, true, err
+}
+
+// backgroundColor parses hex, defaulting to the average color of input.
+func backgroundColor(input image.Image, hex string) (*primitive.Color, error) {
+	if hex == "" {
+		return primitive.MakeColor(primitive.AverageImageColor(input)), nil
+	}
+	return primitive.MakeHexColor(hex)
+}
+
+// outputImage returns the function that draws the image to save: the
+// model's canvas, or if native is set the model rendered at size with the
+// scanline rasterizer.
+func outputImage(model *primitive.Model, size int, native bool) func() (image.Image, error) {
+	if !native {
+		return func() (image.Image, error) {
+			return model.Context.Image(), nil
+		}
+	}
+	return func() (image.Image, error) {
+		return renderImage(model, size, primitive.RenderOptions{Supersample: 1, Native: true})
+	}
+}
+
+// renderImage is model.Render for callers that want an image.Image.
+func renderImage(model *primitive.Model, size int, opts primitive.RenderOptions) (image.Image, error) {
+	im, err := model.Render(size, opts)
+	if err != nil {
+		return nil, err
+	}
+	return im, nil
+}
+
+func saveOutput(ctx context.Context, model *primitive.Model, path, ext string, im func() (image.Image, error)) error {
+	switch ext {
+	default:
+		return fmt.Errorf("unrecognized file extension: %s", ext)
+	case ".png":
+		m, err := im()
+		if err != nil {
+			return err
+		}
+		return primitive.SavePNG(path, m)
+	case ".jpg", ".jpeg":
+		m, err := im()
+		if err != nil {
+			return err
+		}
+		return primitive.SaveJPG(path, m, 95)
+	case ".svg":
+		return primitive.SaveFile(path, model.SVG())
+	case ".json":
+		b, err := model.JSON()
+		if err != nil {
+			return err
+		}
+		return primitive.SaveFile(path, string(b))
+	case ".gif":
+		frames := model.Frames(0.001)
+		return primitive.SaveGIFImageMagick(ctx, path, frames, 50, 250)
 	}
-	return nil
 }
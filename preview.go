@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fogleman/primitive/primitive"
+)
+
+type previewEvent struct {
+	Data any
+	Name string
+}
+
+type previewProgress struct {
+	NPS   string  `json:"nps"`
+	Frame int     `json:"frame"`
+	Score float64 `json:"score"`
+}
+
+// preview streams accepted shapes to browsers, which draw them on a canvas.
+// It keeps the shapes added so far so that late clients can catch up.
+type preview struct {
+	clients map[chan previewEvent]struct{}
+	file    primitive.ShapeFile
+	mu      sync.Mutex
+}
+
+func newPreview(model *primitive.Model) *preview {
+	p := &preview{
+		clients: make(map[chan previewEvent]struct{}),
+		file:    *model.ShapeFile(),
+		mu:      sync.Mutex{},
+	}
+	model.OnAdd = p.add
+	return p
+}
+
+func (p *preview) add(shape primitive.Shape, color primitive.Color, gradient *primitive.Gradient, score float64) {
+	record := primitive.NewShapeRecord(shape, color, gradient, score)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.file.Shapes = append(p.file.Shapes, record)
+	p.broadcastLocked(previewEvent{Name: "shape", Data: record})
+}
+
+func (p *preview) progress(pr primitive.Progress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.clients) == 0 {
+		return
+	}
+	nps := primitive.NumberString(pr.NPS())
+	p.broadcastLocked(previewEvent{Name: "progress", Data: previewProgress{nps, pr.Frame, pr.Score}})
+}
+
+// broadcastLocked sends e to every client without blocking. Clients that
+// fall behind are disconnected rather than slowing down the optimizer.
+func (p *preview) broadcastLocked(e previewEvent) {
+	for ch := range p.clients {
+		select {
+		case ch <- e:
+		default:
+			delete(p.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+func (p *preview) subscribe() chan previewEvent {
+	ch := make(chan previewEvent, 256)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	file := p.file
+	file.Shapes = append([]primitive.ShapeRecord{}, p.file.Shapes...)
+	ch <- previewEvent{Name: "init", Data: file}
+	p.clients[ch] = struct{}{}
+	return ch
+}
+
+func (p *preview) unsubscribe(ch chan previewEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.clients[ch]; ok {
+		delete(p.clients, ch)
+		close(ch)
+	}
+}
+
+func (p *preview) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if _, err := w.Write([]byte(previewPage)); err != nil {
+			slog.ErrorContext(r.Context(), "writing preview", slog.String("error", err.Error()))
+		}
+	})
+	mux.HandleFunc("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		sse, err := newEventStream(w)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ch := p.subscribe()
+		defer p.unsubscribe(ch)
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case e, ok := <-ch:
+				if !ok {
+					return
+				}
+				if err := sse.Send(e.Name, e.Data); err != nil {
+					return
+				}
+			}
+		}
+	})
+	return mux
+}
+
+// serve listens on addr until ctx is canceled.
+func (p *preview) serve(ctx context.Context, addr string) error {
+	lc := net.ListenConfig{
+		Control:         nil,
+		KeepAlive:       0,
+		KeepAliveConfig: net.KeepAliveConfig{Enable: false, Idle: 0, Interval: 0, Count: 0},
+	}
+	ln, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	// http.Server gains fields with Go releases, and the zero value of
+	// each is its default.
+	srv := &http.Server{ //nolint:exhaustruct
+		Handler:           p.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext: func(_ net.Listener) context.Context {
+			return ctx
+		},
+	}
+	go func() {
+		<-ctx.Done()
+		if err := srv.Close(); err != nil {
+			slog.ErrorContext(ctx, "closing preview", slog.String("error", err.Error()))
+		}
+	}()
+	slog.WarnContext(ctx, "serving preview", slog.String("addr", ln.Addr().String()))
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.ErrorContext(ctx, "serving preview", slog.String("error", err.Error()))
+		}
+	}()
+	return nil
+}
+
+const previewPage = `<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>primitive preview</title>
+<style>
+body {
+    margin: 0;
+    padding: 8px;
+    font-family: sans-serif;
+}
+canvas {
+    display: block;
+    max-width: 100%;
+}
+#status {
+    margin-top: 8px;
+    font-size: 12px;
+    color: #555;
+}
+</style>
+</head>
+<body>
+<canvas id="canvas"></canvas>
+<div id="status">waiting...</div>
+<script>
+const size = 768;
+const caps = ["round", "butt", "square"];
+const joins = ["round", "bevel"];
+const blends = {multiply: "multiply", screen: "screen", add: "lighter", difference: "difference"};
+const canvas = document.getElementById("canvas");
+const status = document.getElementById("status");
+const ctx = canvas.getContext("2d");
+let scale = 1;
+let count = 0;
+
+function init(file) {
+    scale = size / Math.max(file.width, file.height);
+    canvas.width = Math.floor(file.width * scale);
+    canvas.height = Math.floor(file.height * scale);
+    ctx.setTransform(1, 0, 0, 1, 0, 0);
+    ctx.fillStyle = file.background;
+    ctx.fillRect(0, 0, canvas.width, canvas.height);
+    ctx.setTransform(scale, 0, 0, scale, scale / 2, scale / 2);
+    ctx.globalCompositeOperation = blends[file.blend] || "source-over";
+    count = 0;
+    for (const shape of file.shapes) {
+        draw(shape);
+    }
+}
+
+function path(p, outline) {
+    ctx.beginPath();
+    for (let i = 0; i < p.length; i += 2) {
+        ctx.lineTo(p[i], p[i + 1]);
+    }
+    ctx.closePath();
+    fillOrStroke(outline);
+}
+
+// fillOrStroke mirrors the Go function: shapes with an outline width are
+// stroked with round joins instead of filled.
+function fillOrStroke(outline) {
+    if (!outline) {
+        ctx.fill();
+        return;
+    }
+    ctx.lineWidth = outline;
+    ctx.lineCap = "round";
+    ctx.lineJoin = "round";
+    ctx.stroke();
+}
+
+// blob mirrors Blob.segment: a closed Catmull-Rom spline through p.
+function blob(p) {
+    const n = p.length / 2;
+    const x = i => p[((i + n) % n) * 2], y = i => p[((i + n) % n) * 2 + 1];
+    ctx.beginPath();
+    ctx.moveTo(x(0), y(0));
+    for (let i = 0; i < n; i++) {
+        ctx.bezierCurveTo(
+            x(i) + (x(i + 1) - x(i - 1)) / 6, y(i) + (y(i + 1) - y(i - 1)) / 6,
+            x(i + 1) - (x(i + 2) - x(i)) / 6, y(i + 1) - (y(i + 2) - y(i)) / 6,
+            x(i + 1), y(i + 1));
+    }
+    ctx.closePath();
+    ctx.fill();
+}
+
+// vertices mirrors unitVertices and placeVertices: n points around x, y
+// whose distances cycle through radii.
+function vertices(x, y, r, angle, n, radii) {
+    const p = [];
+    for (let i = 0; i < n; i++) {
+        const a = 2 * Math.PI * i / n - Math.PI / 2 + angle * Math.PI / 180;
+        const d = r * radii[i % radii.length];
+        p.push(x + Math.cos(a) * d, y + Math.sin(a) * d);
+    }
+    return p;
+}
+
+// paint mirrors Gradient. Canvas gradients are placed in the coordinates
+// in use when a shape is filled, so shapes are drawn without transforms
+// where they can be.
+function paint(shape) {
+    const g = shape.gradient;
+    if (!g) {
+        return shape.color;
+    }
+    const result = g.radial ?
+        ctx.createRadialGradient(g.x1, g.y1, 0, g.x1, g.y1, g.r || 0) :
+        ctx.createLinearGradient(g.x1, g.y1, g.x2 || 0, g.y2 || 0);
+    result.addColorStop(0, shape.color);
+    result.addColorStop(1, g.color);
+    return result;
+}
+
+function draw(shape) {
+    const p = shape.params;
+    const rad = Math.PI / 180;
+    ctx.fillStyle = paint(shape);
+    ctx.strokeStyle = ctx.fillStyle;
+    switch (shape.type) {
+    case "triangle":
+    case "polygon": {
+        // an odd param is the outline width
+        const n = p.length - p.length % 2;
+        path(p.slice(0, n), p[n]);
+        break;
+    }
+    case "rectangle": {
+        const x = Math.min(p[0], p[2]), y = Math.min(p[1], p[3]);
+        ctx.fillRect(x, y, Math.abs(p[2] - p[0]) + 1, Math.abs(p[3] - p[1]) + 1);
+        break;
+    }
+    case "ellipse":
+    case "circle":
+        ctx.beginPath();
+        ctx.ellipse(p[0], p[1], p[2], p[3], 0, 0, 2 * Math.PI);
+        fillOrStroke(p[4]);
+        break;
+    case "rotatedellipse":
+        ctx.beginPath();
+        ctx.ellipse(p[0], p[1], p[2], p[3], p[4] * rad, 0, 2 * Math.PI);
+        fillOrStroke(p[5]);
+        break;
+    case "rotatedrectangle": {
+        const c = Math.cos(p[4] * rad), s = Math.sin(p[4] * rad);
+        const corner = (u, v) => [p[0] + u * c - v * s, p[1] + u * s + v * c];
+        const w = p[2] / 2, h = p[3] / 2;
+        path([...corner(-w, -h), ...corner(w, -h), ...corner(w, h), ...corner(-w, h)]);
+        break;
+    }
+    case "quadratic":
+        ctx.beginPath();
+        ctx.moveTo(p[0], p[1]);
+        ctx.quadraticCurveTo(p[2], p[3], p[4], p[5]);
+        ctx.lineWidth = p[6];
+        ctx.lineCap = "round";
+        ctx.stroke();
+        break;
+    case "cubic":
+        ctx.beginPath();
+        ctx.moveTo(p[0], p[1]);
+        ctx.bezierCurveTo(p[2], p[3], p[4], p[5], p[6], p[7]);
+        ctx.lineWidth = p[8];
+        ctx.lineCap = "round";
+        ctx.stroke();
+        break;
+    case "blob":
+        blob(p);
+        break;
+    case "line":
+        ctx.beginPath();
+        ctx.moveTo(p[0], p[1]);
+        ctx.lineTo(p[2], p[3]);
+        ctx.lineWidth = p[4];
+        ctx.lineCap = caps[p[5]];
+        ctx.stroke();
+        break;
+    case "glyph":
+        // the page does not have the run's font, so this is approximate
+        ctx.save();
+        ctx.translate(p[0], p[1]);
+        ctx.rotate(p[3] * rad);
+        ctx.font = p[2] + "px sans-serif";
+        ctx.textAlign = "center";
+        ctx.textBaseline = "middle";
+        ctx.fillText(String.fromCodePoint(p[4]), 0, 0);
+        ctx.restore();
+        break;
+    case "stamp":
+        // nor its sprite, so stamps are drawn as discs
+        ctx.beginPath();
+        ctx.arc(p[0], p[1], p[2] / 2, 0, 2 * Math.PI);
+        ctx.fill();
+        break;
+    case "polyline": {
+        const n = p.length - 3;
+        ctx.beginPath();
+        for (let i = 0; i < n; i += 2) {
+            ctx.lineTo(p[i], p[i + 1]);
+        }
+        ctx.lineWidth = p[n];
+        ctx.lineCap = caps[p[n + 1]];
+        ctx.lineJoin = joins[p[n + 2]];
+        ctx.stroke();
+        break;
+    }
+    case "regularpolygon":
+        path(vertices(p[0], p[1], p[2], p[3], p[4], [1]));
+        break;
+    case "star":
+        path(vertices(p[0], p[1], p[2], p[3], p[4] * 2, [1, p[5]]));
+        break;
+    }
+    count++;
+}
+
+const events = new EventSource("events");
+events.addEventListener("init", e => init(JSON.parse(e.data)));
+events.addEventListener("shape", e => draw(JSON.parse(e.data)));
+events.addEventListener("progress", e => {
+    const p = JSON.parse(e.data);
+    status.textContent = "frame " + p.frame + ", shapes " + count + ", score " + p.score.toFixed(6) + ", " + p.nps + " evaluations/s";
+});
+events.onerror = () => {
+    status.textContent += " (disconnected)";
+    events.close();
+};
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,108 @@
+package primitive
+
+import (
+	"image"
+	"math"
+)
+
+// solveAlpha returns the alpha, between opts.AlphaMin and opts.AlphaMax,
+// that together with its color best fits the target where the scanlines
+// are drawn. For flat colors in the normal blend mode the alpha and color
+// are solved jointly in closed form. Otherwise, or when the color is then
+// snapped to a palette, the alpha is refined by alternately computing the
+// paint for it and fitting the alpha to that paint. In the multiply and
+// screen modes only the product of alpha and color matters, so any alpha
+// the colors can make up for fits equally well.
+func solveAlpha(target, current *image.RGBA, lines []Scanline, opts *ShapeOptions) int {
+	lo, hi := opts.alphaRange()
+	alpha := (lo + hi) / 2
+	if opts.Blend == BlendNormal && opts.Fill == FillFlat {
+		alpha = jointAlpha(target, current, lines, lo, hi)
+		if opts.Palette == nil {
+			return alpha
+		}
+	}
+	for range 2 {
+		c, g := computePaint(target, current, lines, alpha, opts)
+		alpha = fitAlpha(target, current, lines, c, g, opts.Blend, alpha, lo, hi)
+	}
+	return alpha
+}
+
+// alphaRange returns the bounds of solved alphas.
+func (opts *ShapeOptions) alphaRange() (int, int) {
+	lo := clampInt(opts.AlphaMin, 1, 255)
+	return lo, clampInt(opts.AlphaMax, lo, 255)
+}
+
+// jointAlpha solves for the alpha a and color s that minimize the squared
+// difference between the target t and d*(1-a) + a*s over the pixels d
+// beneath the shape. Writing v = a*s, the fit is linear in a and v; for a
+// given a, each v is the mean of t - d*(1-a), which leaves a as minus the
+// covariance of t-d with d over the variance of d, summed over channels.
+// Where the pixels beneath are uniform any alpha fits as well as any
+// other, and the most opaque is used.
+func jointAlpha(target, current *image.RGBA, lines []Scanline, lo, hi int) int {
+	var n int64
+	var sd, se, sdd, sed [3]int64
+	for _, line := range lines {
+		i := target.PixOffset(line.X1, line.Y)
+		for x := line.X1; x <= line.X2; x++ {
+			for j := range 3 {
+				d := int64(current.Pix[i+j])
+				e := int64(target.Pix[i+j]) - d
+				sd[j] += d
+				se[j] += e
+				sdd[j] += d * d
+				sed[j] += e * d
+			}
+			n++
+			i += 4
+		}
+	}
+	if n == 0 {
+		return hi
+	}
+	var covariance, variance float64
+	for j := range 3 {
+		fn := float64(n)
+		covariance += float64(sed[j]) - float64(se[j])*float64(sd[j])/fn
+		variance += float64(sdd[j]) - float64(sd[j])*float64(sd[j])/fn
+	}
+	if variance < 1e-9 {
+		return hi
+	}
+	return clampInt(int(math.Round(-covariance/variance*255)), lo, hi)
+}
+
+// fitAlpha returns the alpha that best fits the target with the shape
+// painted with c, or the gradient g starting at c, in the given blend mode.
+// Each pixel becomes d + a*(blend(s, d) - d), so a is found by least
+// squares in one variable. alpha is returned if it cannot be improved.
+func fitAlpha(target, current *image.RGBA, lines []Scanline, c Color, g *Gradient, mode BlendMode, alpha, lo, hi int) int {
+	src := [3]uint32{uint32(c.R), uint32(c.G), uint32(c.B)}
+	var ske, skk float64
+	for _, line := range lines {
+		y := float64(line.Y)
+		i := target.PixOffset(line.X1, line.Y)
+		for x := line.X1; x <= line.X2; x++ {
+			if g != nil {
+				t := g.offset(float64(x), y)
+				src[0] = uint32(math.Round(float64(c.R) + float64(g.Color.R-c.R)*t))
+				src[1] = uint32(math.Round(float64(c.G) + float64(g.Color.G-c.G)*t))
+				src[2] = uint32(math.Round(float64(c.B) + float64(g.Color.B-c.B)*t))
+			}
+			for j := range 3 {
+				d := uint32(current.Pix[i+j])
+				k := float64(mode.blend(src[j], d)) - float64(d)
+				ske += k * (float64(target.Pix[i+j]) - float64(d))
+				skk += k * k
+			}
+			i += 4
+		}
+	}
+	if skk == 0 {
+		return alpha
+	}
+	return clampInt(int(math.Round(ske/skk*255)), lo, hi)
+}
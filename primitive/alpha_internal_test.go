@@ -0,0 +1,101 @@
+package primitive
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSolveAlpha draws a known color and alpha over a varied backdrop and
+// checks that both are solved back from the result.
+func TestSolveAlpha(t *testing.T) {
+	t.Parallel()
+	want := Color{R: 200, G: 40, B: 120, A: 96}
+	current := blendBackdrop()
+	target := copyRGBA(current)
+	lines := fullLines(16, 16)
+	drawLines(target, want, lines)
+	opts := DefaultShapeOptions()
+	got, _ := computePaint(target, current, lines, 0, &opts)
+	for _, d := range []int{got.R - want.R, got.G - want.G, got.B - want.B, got.A - want.A} {
+		if d < -3 || d > 3 {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+
+	opts.AlphaMin, opts.AlphaMax = 128, 255
+	if got, _ := computePaint(target, current, lines, 0, &opts); got.A != 128 {
+		t.Errorf("got alpha %d, want it raised to the minimum of 128", got.A)
+	}
+	opts.AlphaMin, opts.AlphaMax = 1, 64
+	if got, _ := computePaint(target, current, lines, 0, &opts); got.A != 64 {
+		t.Errorf("got alpha %d, want it lowered to the maximum of 64", got.A)
+	}
+}
+
+// TestSolveAlphaFitted checks the alternating fit used for blend modes and
+// palettes.
+func TestSolveAlphaFitted(t *testing.T) {
+	t.Parallel()
+	want := Color{R: 90, G: 160, B: 40, A: 160}
+	current := blendBackdrop()
+	target := copyRGBA(current)
+	lines := fullLines(16, 16)
+	drawBlendLines(target, want, nil, BlendDifference, lines)
+	opts := DefaultShapeOptions()
+	opts.Blend = BlendDifference
+	got, _ := computePaint(target, current, lines, 0, &opts)
+	if d := got.A - want.A; d < -8 || d > 8 {
+		t.Errorf("difference: got %v, want %v", got, want)
+	}
+
+	target = copyRGBA(current)
+	drawLines(target, want, lines)
+	opts = DefaultShapeOptions()
+	opts.Palette = NewPalette([]Color{{0, 0, 0, 255}, {90, 160, 40, 255}})
+	got, _ = computePaint(target, current, lines, 0, &opts)
+	if got.R != want.R || got.G != want.G || got.B != want.B {
+		t.Fatalf("palette: got %v, want %v", got, want)
+	}
+	if d := got.A - want.A; d < -8 || d > 8 {
+		t.Errorf("palette: got %v, want %v", got, want)
+	}
+}
+
+func TestStageAlpha(t *testing.T) {
+	t.Parallel()
+	stage := Stage{Count: 5, ShapeType: ShapeTypeTriangle, Alpha: 255, AlphaEnd: 55, Repeat: 0, Tiles: 0}
+	for i, want := range []int{255, 205, 155, 105, 55} {
+		if got := stage.alpha(i); got != want {
+			t.Errorf("alpha(%d) = %d, want %d", i, got, want)
+		}
+	}
+	stage.AlphaEnd = 0
+	if got := stage.alpha(3); got != 255 {
+		t.Errorf("got %d without a schedule, want 255", got)
+	}
+}
+
+func TestProgressNPS(t *testing.T) {
+	t.Parallel()
+	p := Progress{
+		Stage:       0,
+		Frame:       1,
+		Frames:      1,
+		Score:       0,
+		Evaluations: 500,
+		Counters:    nil,
+		Workers:     nil,
+		Shapes:      1,
+		ShapeType:   ShapeTypeTriangle,
+		Alpha:       128,
+		Duration:    0,
+		Elapsed:     0,
+	}
+	if got := p.NPS(); got != 0 {
+		t.Errorf("got %v for a step that took no time, want 0", got)
+	}
+	p.Duration = 250 * time.Millisecond
+	if got := p.NPS(); got != 2000 {
+		t.Errorf("got %v, want 2000", got)
+	}
+}
@@ -0,0 +1,95 @@
+package primitive_test
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"testing"
+
+	"github.com/fogleman/primitive/primitive"
+	"github.com/nfnt/resize"
+)
+
+var benchShapeTypes = []primitive.ShapeType{
+	primitive.ShapeTypeTriangle,
+	primitive.ShapeTypeRectangle,
+	primitive.ShapeTypeEllipse,
+	primitive.ShapeTypeCircle,
+	primitive.ShapeTypeRotatedRectangle,
+	primitive.ShapeTypeQuadratic,
+	primitive.ShapeTypeRotatedEllipse,
+	primitive.ShapeTypePolygon,
+	primitive.ShapeTypeCubic,
+	primitive.ShapeTypeBlob,
+	primitive.ShapeTypeLine,
+	primitive.ShapeTypePolyline,
+	primitive.ShapeTypeRegularPolygon,
+	primitive.ShapeTypeStar,
+}
+
+func loadBenchImage(b *testing.B) image.Image {
+	b.Helper()
+	im, err := primitive.LoadImage("../examples/monalisa.png")
+	if err != nil {
+		b.Fatal(err)
+	}
+	return resize.Thumbnail(128, 128, im, resize.Bilinear)
+}
+
+func newBenchModel(b *testing.B, workers int) *primitive.Model {
+	b.Helper()
+	im := loadBenchImage(b)
+	bg := primitive.MakeColor(primitive.AverageImageColor(im))
+	model := primitive.NewModel(im, bg, 128, workers)
+	model.Seed(1)
+	b.Cleanup(model.Close)
+	return model
+}
+
+func BenchmarkEnergy(b *testing.B) {
+	for _, t := range benchShapeTypes {
+		b.Run(t.String(), func(b *testing.B) {
+			model := newBenchModel(b, 1)
+			worker := model.Workers[0]
+			worker.Init(model.Current, model.Total)
+			states := make([]*primitive.State, 1024)
+			for i := range states {
+				states[i] = worker.RandomState(t, 128)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				state := states[i%len(states)]
+				worker.Energy(state.Shape, state.Alpha)
+			}
+		})
+	}
+}
+
+func BenchmarkStep(b *testing.B) {
+	for _, t := range benchShapeTypes {
+		b.Run(t.String(), func(b *testing.B) {
+			model := newBenchModel(b, 1)
+			b.ResetTimer()
+			evaluations := 0
+			for i := 0; i < b.N; i++ {
+				evaluations += model.Step(context.Background(), t, 128, 0)
+			}
+			b.ReportMetric(float64(evaluations)/b.Elapsed().Seconds(), "evals/s")
+			b.ReportMetric(model.Score, "score")
+		})
+	}
+}
+
+func BenchmarkStepWorkers(b *testing.B) {
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprint(workers), func(b *testing.B) {
+			model := newBenchModel(b, workers)
+			b.ResetTimer()
+			evaluations := 0
+			for i := 0; i < b.N; i++ {
+				evaluations += model.Step(context.Background(), primitive.ShapeTypeTriangle, 128, 0)
+			}
+			b.ReportMetric(float64(evaluations)/b.Elapsed().Seconds(), "evals/s")
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package primitive
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/fogleman/gg"
+)
+
+// BlendMode is how a shape's color combines with the pixels beneath it
+// before the result is mixed in at the shape's alpha. BlendNormal is plain
+// source-over compositing.
+type BlendMode int
+
+const (
+	BlendNormal BlendMode = iota
+	BlendMultiply
+	BlendScreen
+	BlendAdd
+	BlendDifference
+)
+
+var blendModeNames = []string{"normal", "multiply", "screen", "add", "difference"}
+
+// svgBlendModes are the CSS mix-blend-mode values of the blend modes.
+var svgBlendModes = []string{"normal", "multiply", "screen", "plus-lighter", "difference"}
+
+func (mode BlendMode) String() string {
+	if mode >= 0 && int(mode) < len(blendModeNames) {
+		return blendModeNames[mode]
+	}
+	return fmt.Sprintf("BlendMode(%d)", int(mode))
+}
+
+func ParseBlendMode(name string) (BlendMode, error) {
+	for i, n := range blendModeNames {
+		if n == name {
+			return BlendMode(i), nil
+		}
+	}
+	return BlendNormal, fmt.Errorf("unknown blend mode: %q", name)
+}
+
+func (mode BlendMode) MarshalText() ([]byte, error) {
+	return []byte(mode.String()), nil
+}
+
+func (mode *BlendMode) UnmarshalText(text []byte) error {
+	m, err := ParseBlendMode(string(text))
+	if err != nil {
+		return err
+	}
+	*mode = m
+	return nil
+}
+
+// blend combines the 8 bit channel values s of the shape and d beneath it.
+func (mode BlendMode) blend(s, d uint32) uint32 {
+	switch mode {
+	case BlendMultiply:
+		return (s*d + 127) / 255
+	case BlendScreen:
+		return s + d - (s*d+127)/255
+	case BlendAdd:
+		return min(s+d, 255)
+	case BlendDifference:
+		if s > d {
+			return s - d
+		}
+		return d - s
+	default:
+		return s
+	}
+}
+
+// drawBlendLines is drawLines, or drawGradientLines if g is not nil, for
+// any blend mode. Each pixel becomes d*(1-a) + blend(s, d)*a, where a is
+// the shape's alpha times the scanline's coverage, as in the W3C
+// compositing model over an opaque backdrop.
+func drawBlendLines(im *image.RGBA, c Color, g *Gradient, mode BlendMode, lines []Scanline) {
+	const m = 0xffff
+	sa := uint32(c.A) * 0x101
+	src := [3]uint32{uint32(c.R), uint32(c.G), uint32(c.B)}
+	for _, line := range lines {
+		a := sa * line.Alpha / m
+		y := float64(line.Y)
+		i := im.PixOffset(line.X1, line.Y)
+		for x := line.X1; x <= line.X2; x++ {
+			if g != nil {
+				t := g.offset(float64(x), y)
+				src[0] = uint32(math.Round(float64(c.R) + float64(g.Color.R-c.R)*t))
+				src[1] = uint32(math.Round(float64(c.G) + float64(g.Color.G-c.G)*t))
+				src[2] = uint32(math.Round(float64(c.B) + float64(g.Color.B-c.B)*t))
+			}
+			for j := range 3 {
+				d := uint32(im.Pix[i+j])
+				im.Pix[i+j] = uint8((d*(m-a) + mode.blend(src[j], d)*a + m/2) / m)
+			}
+			im.Pix[i+3] = uint8((uint32(im.Pix[i+3])*(m-a) + 255*a + m/2) / m)
+			i += 4
+		}
+	}
+}
+
+// computeBlendColor is computeColor for blend modes other than normal. The
+// color is solved per channel by least squares. Multiply and screen are
+// linear in the shape's color, so they have a closed form. Add, which is
+// clamped at white, and difference are solved by trying every value.
+func computeBlendColor(target, current *image.RGBA, lines []Scanline, alpha int, mode BlendMode) Color {
+	if mode == BlendAdd || mode == BlendDifference {
+		return computeBlendColorScan(target, current, lines, alpha, mode)
+	}
+	a := float64(alpha) / 255
+	n := 0
+	var ske, skk [3]float64
+	for _, line := range lines {
+		i := target.PixOffset(line.X1, line.Y)
+		for x := line.X1; x <= line.X2; x++ {
+			for j := range 3 {
+				t := float64(target.Pix[i+j])
+				d := float64(current.Pix[i+j])
+				// the result is t - e + k*s, which should be t
+				e, k := t-d*(1-a), a*d/255
+				if mode == BlendScreen {
+					e, k = t-d, a*(1-d/255)
+				}
+				ske[j] += k * e
+				skk[j] += k * k
+			}
+			n++
+			i += 4
+		}
+	}
+	if n == 0 {
+		return Color{R: 0, G: 0, B: 0, A: 0}
+	}
+	var result [3]int
+	for j := range 3 {
+		if skk[j] > 0 {
+			result[j] = clampInt(int(math.Round(ske[j]/skk[j])), 0, 255)
+		}
+	}
+	return Color{result[0], result[1], result[2], alpha}
+}
+
+// computeBlendColorScan finds the color for add and difference by trying
+// all 256 values of each channel. The pixels are first summed by the value
+// beneath them, so that each try costs the same however many pixels the
+// shape covers.
+func computeBlendColorScan(target, current *image.RGBA, lines []Scanline, alpha int, mode BlendMode) Color {
+	a := float64(alpha) / 255
+	n := 0
+	var count, sum [3][256]float64
+	for _, line := range lines {
+		i := target.PixOffset(line.X1, line.Y)
+		for x := line.X1; x <= line.X2; x++ {
+			for j := range 3 {
+				t := float64(target.Pix[i+j])
+				d := current.Pix[i+j]
+				// the residual before the shape's own term is subtracted
+				e := t - float64(d)
+				if mode == BlendDifference {
+					e = t - float64(d)*(1-a)
+				}
+				count[j][d]++
+				sum[j][d] += e
+			}
+			n++
+			i += 4
+		}
+	}
+	if n == 0 {
+		return Color{R: 0, G: 0, B: 0, A: 0}
+	}
+	var result [3]int
+	for j := range 3 {
+		var totalCount, totalSum, totalD, totalSumD float64
+		for d := range 256 {
+			fd := float64(d)
+			totalCount += count[j][d]
+			totalSum += sum[j][d]
+			totalD += count[j][d] * fd
+			totalSumD += sum[j][d] * fd
+		}
+		best, bestCost := 0, math.Inf(1)
+		// sums over the pixels whose term no longer depends on s
+		var fixed, fixedCount, fixedSum, fixedSumD float64
+		for s := range 256 {
+			fs := float64(s)
+			var cost float64
+			if mode == BlendAdd {
+				// each pixel costs (e - a*min(s, 255-d))^2; the pixels with
+				// 255-d <= s are clamped and constant from here on
+				d := 255 - s
+				fixed += -2*a*fs*sum[j][d] + a*a*fs*fs*count[j][d]
+				fixedCount += count[j][d]
+				fixedSum += sum[j][d]
+				cost = fixed - 2*a*fs*(totalSum-fixedSum) + a*a*fs*fs*(totalCount-fixedCount)
+			} else {
+				// each pixel costs (e - a*|s-d|)^2; split at d <= s
+				fixedSum += sum[j][s]
+				fixedSumD += sum[j][s] * fs
+				abs := fs*(fixedSum-(totalSum-fixedSum)) - (fixedSumD - (totalSumD - fixedSumD))
+				cost = -2*a*abs + a*a*(totalCount*fs*fs-2*fs*totalD)
+			}
+			if cost < bestCost {
+				best, bestCost = s, cost
+			}
+		}
+		result[j] = best
+	}
+	return Color{result[0], result[1], result[2], alpha}
+}
+
+// drawShape draws a shape filled with c, or the gradient g starting at c,
+// on dc with the given blend mode. gg only composites source-over, so for
+// other modes the shape is drawn opaque on a scratch context of the same
+// size and transform, which must not rotate or skew, and each covered
+// pixel is then blended into dc's image.
+func drawShape(dc *gg.Context, shape Shape, c Color, g *Gradient, mode BlendMode, scale float64) {
+	if mode == BlendNormal {
+		setPaint(dc, c, g)
+		shape.Draw(dc, scale)
+		return
+	}
+	w, h := dc.Width(), dc.Height()
+	x0, y0 := dc.TransformPoint(0, 0)
+	x1, _ := dc.TransformPoint(1, 0)
+	_, y1 := dc.TransformPoint(0, 1)
+	scratch := gg.NewContext(w, h)
+	scratch.Translate(x0, y0)
+	scratch.Scale(x1-x0, y1-y0)
+	opaque := c
+	opaque.A = 255
+	if g != nil {
+		end := *g
+		end.Color.A = 255
+		g = &end
+	}
+	setPaint(scratch, opaque, g)
+	shape.Draw(scratch, scale)
+	src, ok := scratch.Image().(*image.RGBA)
+	dst, ok2 := dc.Image().(*image.RGBA)
+	if !ok || !ok2 {
+		panic("primitive: gg context is not RGBA")
+	}
+	const m = 0xffff
+	sa := uint32(c.A) * 0x101
+	for i := 0; i < len(src.Pix); i += 4 {
+		coverage := uint32(src.Pix[i+3])
+		if coverage == 0 {
+			continue
+		}
+		a := sa * coverage / 255
+		for j := range 3 {
+			// the scratch image is premultiplied by coverage
+			s := (uint32(src.Pix[i+j])*255 + coverage/2) / coverage
+			d := uint32(dst.Pix[i+j])
+			dst.Pix[i+j] = uint8((d*(m-a) + mode.blend(min(s, 255), d)*a + m/2) / m)
+		}
+		dst.Pix[i+3] = uint8((uint32(dst.Pix[i+3])*(m-a) + 255*a + m/2) / m)
+	}
+}
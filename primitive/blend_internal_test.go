@@ -0,0 +1,162 @@
+package primitive
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var blendModes = []BlendMode{BlendMultiply, BlendScreen, BlendAdd, BlendDifference}
+
+func TestBlend(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		mode       BlendMode
+		s, d, want uint32
+	}{
+		{BlendNormal, 100, 200, 100},
+		{BlendMultiply, 255, 200, 200},
+		{BlendMultiply, 128, 128, 64},
+		{BlendScreen, 0, 200, 200},
+		{BlendScreen, 128, 128, 192},
+		{BlendAdd, 100, 100, 200},
+		{BlendAdd, 200, 100, 255},
+		{BlendDifference, 100, 30, 70},
+		{BlendDifference, 30, 100, 70},
+	}
+	for _, tt := range tests {
+		if got := tt.mode.blend(tt.s, tt.d); got != tt.want {
+			t.Errorf("%s(%d, %d) = %d, want %d", tt.mode, tt.s, tt.d, got, tt.want)
+		}
+	}
+}
+
+// blendBackdrop is a backdrop whose channels vary, so that the blend modes
+// can be told apart from a flat color drawn over it.
+func blendBackdrop() *image.RGBA {
+	im := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			im.SetRGBA(x, y, color.RGBA{uint8(x * 9), uint8(60 + y*5), uint8(150 - x*4), 255})
+		}
+	}
+	return im
+}
+
+// TestComputeBlendColor draws a known color with each mode and checks that
+// the color is solved back from the result.
+func TestComputeBlendColor(t *testing.T) {
+	t.Parallel()
+	want := Color{R: 90, G: 160, B: 40, A: 192}
+	for _, mode := range blendModes {
+		t.Run(mode.String(), func(t *testing.T) {
+			t.Parallel()
+			current := blendBackdrop()
+			target := copyRGBA(current)
+			lines := fullLines(16, 16)
+			drawBlendLines(target, want, nil, mode, lines)
+			opts := DefaultShapeOptions()
+			opts.Blend = mode
+			got, g := computePaint(target, current, lines, want.A, &opts)
+			if g != nil {
+				t.Fatalf("got gradient %+v", g)
+			}
+			for _, d := range []int{got.R - want.R, got.G - want.G, got.B - want.B} {
+				if d < -2 || d > 2 {
+					t.Fatalf("got %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDrawBlendLinesNormal(t *testing.T) {
+	t.Parallel()
+	c := Color{R: 200, G: 40, B: 90, A: 100}
+	lines := fullLines(16, 16)
+	for i := range lines {
+		lines[i].Alpha = uint32(i+1) * 0xffff / 16
+	}
+	want := blendBackdrop()
+	got := copyRGBA(want)
+	drawLines(want, c, lines)
+	drawBlendLines(got, c, nil, BlendNormal, lines)
+	for i := range got.Pix {
+		if d := int(got.Pix[i]) - int(want.Pix[i]); d < -1 || d > 1 {
+			t.Fatalf("pixel %d: got %d, want %d", i/4, got.Pix[i], want.Pix[i])
+		}
+	}
+}
+
+func blendShapeFile(mode BlendMode) *ShapeFile {
+	return &ShapeFile{
+		Background: Color{R: 200, G: 180, B: 60, A: 255},
+		Shapes: []ShapeRecord{
+			{Type: ShapeTypeRectangle.String(), Params: []float64{4, 4, 40, 40}, Color: Color{R: 40, G: 120, B: 220, A: 200}, Gradient: nil, Score: 0},
+			{Type: ShapeTypeCircle.String(), Params: []float64{40, 40, 18, 18}, Color: Color{R: 220, G: 60, B: 100, A: 160}, Gradient: nil, Score: 0},
+		},
+		Blend:  mode,
+		Width:  goldenSize,
+		Height: goldenSize,
+	}
+}
+
+// TestBlendMatchesDraw checks that gg output is blended like the scanline
+// renderer, away from the edges of the shapes.
+func TestBlendMatchesDraw(t *testing.T) {
+	t.Parallel()
+	for _, mode := range blendModes {
+		t.Run(mode.String(), func(t *testing.T) {
+			t.Parallel()
+			model, err := blendShapeFile(mode).Model(goldenSize, DefaultShapeOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := model.Current
+			b := imageToRGBA(model.Context.Image())
+			// pixels well inside the rectangle, the circle and their overlap
+			for _, p := range []image.Point{{10, 10}, {30, 20}, {48, 48}, {36, 36}} {
+				ca, cb := a.RGBAAt(p.X, p.Y), b.RGBAAt(p.X, p.Y)
+				for _, d := range []int{int(ca.R) - int(cb.R), int(ca.G) - int(cb.G), int(ca.B) - int(cb.B)} {
+					if d < -2 || d > 2 {
+						t.Errorf("%v: got %v drawn, want %v", p, cb, ca)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBlendRoundTrip(t *testing.T) {
+	t.Parallel()
+	for _, mode := range blendModes {
+		t.Run(mode.String(), func(t *testing.T) {
+			t.Parallel()
+			want := blendShapeFile(mode)
+			model, err := want.Model(goldenSize, DefaultShapeOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			svg := model.SVG()
+			if !strings.Contains(svg, "mix-blend-mode: "+svgBlendModes[mode]) {
+				t.Errorf("svg has no mix-blend-mode for %s", mode)
+			}
+			file, err := ReadSVG(strings.NewReader(svg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(file, want) {
+				t.Errorf("svg: got %+v, want %+v", file, want)
+			}
+			b, err := model.JSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(b), `"blend": "`+mode.String()+`"`) {
+				t.Errorf("json has no blend mode: %s", b)
+			}
+		})
+	}
+}
@@ -50,3 +50,16 @@ func MakeHexColor(x string) (*Color, error) {
 func (c *Color) NRGBA() color.NRGBA {
 	return color.NRGBA{uint8(c.R), uint8(c.G), uint8(c.B), uint8(c.A)}
 }
+
+func (c Color) MarshalText() ([]byte, error) {
+	return fmt.Appendf(nil, "#%02x%02x%02x%02x", c.R, c.G, c.B, c.A), nil
+}
+
+func (c *Color) UnmarshalText(text []byte) error {
+	x, err := MakeHexColor(string(text))
+	if err != nil {
+		return err
+	}
+	*c = *x
+	return nil
+}
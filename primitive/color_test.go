@@ -0,0 +1,54 @@
+package primitive_test
+
+import (
+	"testing"
+
+	"github.com/fogleman/primitive/primitive"
+)
+
+func TestMakeHexColor(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in   string
+		want primitive.Color
+	}{
+		{"#000", primitive.Color{R: 0, G: 0, B: 0, A: 255}},
+		{"fff", primitive.Color{R: 255, G: 255, B: 255, A: 255}},
+		{"#1a2", primitive.Color{R: 0x11, G: 0xaa, B: 0x22, A: 255}},
+		{"#1a28", primitive.Color{R: 0x11, G: 0xaa, B: 0x22, A: 0x88}},
+		{"#FF8000", primitive.Color{R: 255, G: 128, B: 0, A: 255}},
+		{"ff800080", primitive.Color{R: 255, G: 128, B: 0, A: 128}},
+		{"##123456#", primitive.Color{R: 0x12, G: 0x34, B: 0x56, A: 255}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			t.Parallel()
+			got, err := primitive.MakeHexColor(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("got %v, want %v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColorText(t *testing.T) {
+	t.Parallel()
+	c := primitive.Color{R: 1, G: 2, B: 254, A: 128}
+	b, err := c.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "#0102fe80" {
+		t.Errorf("got %s, want #0102fe80", b)
+	}
+	var got primitive.Color
+	if err := got.UnmarshalText(b); err != nil {
+		t.Fatal(err)
+	}
+	if got != c {
+		t.Errorf("got %v, want %v", got, c)
+	}
+}
@@ -0,0 +1,258 @@
+package primitive
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Constraints limit the shapes of one type that workers generate, and set
+// how far a mutation moves them. Sizes are in pixels of the scoring image.
+type Constraints struct {
+	// Angles lists the rotations in degrees that rotated shapes may take.
+	// If it is empty, any rotation is allowed.
+	Angles []float64 `json:"angles"`
+	// MinSize and MaxSize bound the longer side of the shape's bounding
+	// box; for circles that is the diameter. A MaxSize of 0 means no limit.
+	MinSize float64 `json:"min_size"`
+	MaxSize float64 `json:"max_size"`
+	// MaxAspect bounds the ratio of the longer side of the bounding box
+	// to the shorter one. 0 means no limit.
+	MaxAspect float64 `json:"max_aspect"`
+	// MinAngle is the smallest interior angle of triangles, in degrees.
+	MinAngle float64 `json:"min_angle"`
+	// Step is the standard deviation of position and size mutations. 0
+	// scales it with the canvas: 16 pixels for every 256.
+	Step float64 `json:"step"`
+	// Margin is how far outside the image points may be moved. 0 scales it
+	// with the canvas like Step.
+	Margin float64 `json:"margin"`
+}
+
+// DefaultConstraints returns the limits shapes of type t have when none are
+// configured: no size, aspect or rotation limits, and steps and margins
+// that scale with the canvas.
+func DefaultConstraints(t ShapeType) Constraints {
+	minAngle := 0.0
+	if t == ShapeTypeTriangle {
+		minAngle = 15
+	}
+	return Constraints{
+		MinSize:   0,
+		MaxSize:   0,
+		MaxAspect: 0,
+		Angles:    nil,
+		MinAngle:  minAngle,
+		Step:      0,
+		Margin:    0,
+	}
+}
+
+// ParseConstraints reads constraints from a JSON object keyed by shape type
+// name. Fields that are left out keep their defaults, and the "any" key
+// sets fields for every type before the type's own key is applied:
+//
+//	{"any": {"step": 8}, "circle": {"min_size": 40}, "rotatedrectangle": {"angles": [0, 45, 90]}}
+func ParseConstraints(data []byte) (map[ShapeType]Constraints, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	for name := range raw {
+		if _, err := ParseShapeType(name); err != nil {
+			return nil, err
+		}
+	}
+	result := make(map[ShapeType]Constraints, len(shapeTypeNames))
+	for t, name := range shapeTypeNames {
+		if t == ShapeTypeAny {
+			continue
+		}
+		c := DefaultConstraints(t)
+		for _, key := range []string{shapeTypeNames[ShapeTypeAny], name} {
+			if b, ok := raw[key]; ok {
+				decoder := json.NewDecoder(bytes.NewReader(b))
+				decoder.DisallowUnknownFields()
+				if err := decoder.Decode(&c); err != nil {
+					return nil, fmt.Errorf("%s: %w", key, err)
+				}
+			}
+		}
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		result[t] = c
+	}
+	return result, nil
+}
+
+// LoadConstraints reads constraints from a JSON file, or from arg itself if
+// it is a JSON object.
+func LoadConstraints(arg string) (map[ShapeType]Constraints, error) {
+	if strings.HasPrefix(strings.TrimSpace(arg), "{") {
+		return ParseConstraints([]byte(arg))
+	}
+	data, err := os.ReadFile(arg)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConstraints(data)
+}
+
+func (c Constraints) validate() error {
+	switch {
+	case c.MinSize < 0:
+		return errors.New("min_size must not be negative")
+	case c.MaxSize < 0 || c.MaxSize > 0 && c.MaxSize < c.MinSize:
+		return errors.New("max_size must be 0 or at least min_size")
+	case c.MaxAspect != 0 && c.MaxAspect < 1:
+		return errors.New("max_aspect must be 0 or at least 1")
+	case c.MinAngle < 0 || c.MinAngle >= 60:
+		return errors.New("min_angle must be at least 0 and less than 60")
+	case c.Step < 0:
+		return errors.New("step must not be negative")
+	case c.Margin < 0:
+		return errors.New("margin must not be negative")
+	}
+	return nil
+}
+
+// CheckConstraints reports constraints that no shape on a w x h canvas can
+// meet: a min_size longer than the canvas, or one whose shorter side at
+// max_aspect would not fit across it. Mutations of such shapes would never
+// find a valid one.
+func CheckConstraints(constraints map[ShapeType]Constraints, w, h int) error {
+	long, short := float64(max(w, h)), float64(min(w, h))
+	for _, t := range slices.Sorted(maps.Keys(constraints)) {
+		c := constraints[t]
+		switch {
+		case c.MinSize > long:
+			return fmt.Errorf("%s: min_size %g is larger than the %dx%d canvas", t, c.MinSize, w, h)
+		case c.MaxAspect > 0 && c.MinSize/c.MaxAspect > short:
+			return fmt.Errorf("%s: min_size %g at max_aspect %g does not fit the %dx%d canvas", t, c.MinSize, c.MaxAspect, w, h)
+		}
+	}
+	return nil
+}
+
+// mutateTries is how many mutations a shape tries to meet its constraints
+// before Mutate gives up and leaves the shape as it was.
+const mutateTries = 1000
+
+// validShape is implemented by shapes that can break their constraints,
+// whether by rounding, by a mutation that gave up or by being spawned that
+// way. Energy rejects such shapes while they are not Valid.
+type validShape interface {
+	Valid() bool
+}
+
+// constraints returns the limits for shapes of type t, with the step and
+// margin in pixels of the worker's canvas. The step is scaled by the
+// worker's StepScale, whether it was derived or configured.
+func (worker *Worker) constraints(t ShapeType) Constraints {
+	c, ok := worker.Options.Constraints[t]
+	if !ok {
+		c = DefaultConstraints(t)
+	}
+	if c.Step == 0 {
+		c.Step = 16 * worker.canvasScale()
+	}
+	c.Step *= worker.StepScale
+	if c.Margin == 0 {
+		c.Margin = 16 * worker.canvasScale()
+	}
+	return c
+}
+
+// fits reports whether a bounding box w by h pixels meets the size and
+// aspect limits.
+func (c Constraints) fits(w, h float64) bool {
+	a, b := math.Max(w, h), math.Min(w, h)
+	if a < c.MinSize || c.MaxSize > 0 && a > c.MaxSize {
+		return false
+	}
+	return c.MaxAspect == 0 || a <= b*c.MaxAspect
+}
+
+// fitsPoints reports whether the bounding box of the points meets the size
+// and aspect limits.
+func (c Constraints) fitsPoints(x, y []float64) bool {
+	if c.MinSize == 0 && c.MaxSize == 0 && c.MaxAspect == 0 {
+		return true
+	}
+	x1, x2 := x[0], x[0]
+	y1, y2 := y[0], y[0]
+	for i := 1; i < len(x); i++ {
+		x1, x2 = math.Min(x1, x[i]), math.Max(x2, x[i])
+		y1, y2 = math.Min(y1, y[i]), math.Max(y2, y[i])
+	}
+	return c.fits(x2-x1, y2-y1)
+}
+
+// fit adjusts the sides a and b of a shape to meet the size and aspect
+// limits. Where the aspect is too large, b is changed rather than a, so a
+// should be the side that was just mutated.
+func (c Constraints) fit(a, b float64) (float64, float64) {
+	if c.MaxSize > 0 {
+		a = math.Min(a, c.MaxSize)
+		b = math.Min(b, c.MaxSize)
+	}
+	if c.MaxAspect > 0 {
+		b = clamp(b, a/c.MaxAspect, a*c.MaxAspect)
+		if c.MaxSize > 0 {
+			b = math.Min(b, c.MaxSize)
+		}
+	}
+	if l := math.Max(a, b); l < c.MinSize {
+		if l == 0 {
+			// a shape rounded away to nothing grows as a square
+			a, b, l = 1, 1, 1
+		}
+		k := c.MinSize / l
+		a *= k
+		b *= k
+	}
+	return a, b
+}
+
+// fitSides is fit for integer sides of at least one pixel.
+func (c Constraints) fitSides(a, b int) (int, int) {
+	fa, fb := c.fit(float64(a), float64(b))
+	return maxInt(1, int(math.Round(fa))), maxInt(1, int(math.Round(fb)))
+}
+
+// fitRadii is fit for the integer radii of an ellipse.
+func (c Constraints) fitRadii(a, b int) (int, int) {
+	fa, fb := c.fit(float64(2*a), float64(2*b))
+	return maxInt(1, int(math.Round(fa/2))), maxInt(1, int(math.Round(fb/2)))
+}
+
+// snapAngle returns the allowed angle nearest to a, or a itself if any
+// angle is allowed.
+func (c Constraints) snapAngle(a float64) float64 {
+	best, bestDelta := a, math.Inf(1)
+	for _, b := range c.Angles {
+		d := math.Abs(math.Mod(a-b, 360))
+		d = math.Min(d, 360-d)
+		if d < bestDelta {
+			best, bestDelta = b, d
+		}
+	}
+	return best
+}
+
+// mutateAngle returns a turned by a random amount, or a random allowed
+// angle if the angles are limited.
+func (c Constraints) mutateAngle(rnd *rand.Rand, a float64) float64 {
+	if len(c.Angles) > 0 {
+		return c.Angles[rnd.Intn(len(c.Angles))]
+	}
+	return a + rnd.NormFloat64()*32
+}
@@ -0,0 +1,201 @@
+package primitive
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestParseConstraints(t *testing.T) {
+	t.Parallel()
+	constraints, err := ParseConstraints([]byte(`{
+		"any": {"step": 8},
+		"circle": {"min_size": 40, "max_size": 60},
+		"rotatedrectangle": {"angles": [0, 45, 90], "step": 4}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := constraints[ShapeTypeTriangle]; c.Step != 8 || c.MinAngle != 15 || c.Margin != 0 {
+		t.Errorf("triangle: got %+v, want step 8 and other defaults", c)
+	}
+	if c := constraints[ShapeTypeCircle]; c.MinSize != 40 || c.MaxSize != 60 || c.Step != 8 {
+		t.Errorf("circle: got %+v", c)
+	}
+	if c := constraints[ShapeTypeRotatedRectangle]; !slices.Equal(c.Angles, []float64{0, 45, 90}) || c.Step != 4 {
+		t.Errorf("rotatedrectangle: got %+v", c)
+	}
+	if _, ok := constraints[ShapeTypeAny]; ok {
+		t.Error("any should not have constraints of its own")
+	}
+}
+
+func TestParseConstraintsInvalid(t *testing.T) {
+	t.Parallel()
+	for _, data := range []string{
+		`{"hexagon": {}}`,
+		`{"circle": {"radius": 4}}`,
+		`{"circle": {"min_size": 40, "max_size": 20}}`,
+		`{"any": {"step": -1}}`,
+		`{"ellipse": {"max_aspect": 0.5}}`,
+		`{"triangle": {"min_angle": 60}}`,
+		`[]`,
+	} {
+		if _, err := ParseConstraints([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+}
+
+func TestConstraintsMutate(t *testing.T) {
+	t.Parallel()
+	target := uniformRGBA(image.Rect(0, 0, 128, 128), color.NRGBA{128, 128, 128, 255})
+	constraints, err := ParseConstraints([]byte(`{
+		"circle": {"min_size": 40, "max_size": 60},
+		"triangle": {"min_size": 30, "max_size": 50, "min_angle": 30},
+		"rotatedrectangle": {"angles": [0, 45, 90], "max_aspect": 2},
+		"rotatedellipse": {"angles": [30], "max_size": 20}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		Check func(Shape) bool
+		Type  ShapeType
+	}{
+		{Type: ShapeTypeCircle, Check: func(s Shape) bool {
+			c, _ := s.(*Ellipse)
+			return c.Rx == c.Ry && c.Rx*2 >= 40 && c.Rx*2 <= 60
+		}},
+		{Type: ShapeTypeTriangle, Check: func(s Shape) bool {
+			tr, _ := s.(*Triangle)
+			w := maxInt(tr.X1, maxInt(tr.X2, tr.X3)) - minInt(tr.X1, minInt(tr.X2, tr.X3))
+			h := maxInt(tr.Y1, maxInt(tr.Y2, tr.Y3)) - minInt(tr.Y1, minInt(tr.Y2, tr.Y3))
+			return maxInt(w, h) >= 30 && maxInt(w, h) <= 50
+		}},
+		{Type: ShapeTypeRotatedRectangle, Check: func(s Shape) bool {
+			r, _ := s.(*RotatedRectangle)
+			ok := r.Angle == 0 || r.Angle == 45 || r.Angle == 90
+			return ok && maxInt(r.Sx, r.Sy) <= 2*minInt(r.Sx, r.Sy)
+		}},
+		{Type: ShapeTypeRotatedEllipse, Check: func(s Shape) bool {
+			e, _ := s.(*RotatedEllipse)
+			return e.Angle == 30 && math.Max(e.Rx, e.Ry)*2 <= 20
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Type.String(), func(t *testing.T) {
+			t.Parallel()
+			worker := NewWorker(target)
+			worker.Rnd = rand.New(rand.NewSource(1))
+			worker.Options.Constraints = constraints
+			state := worker.RandomState(tt.Type, 128)
+			for i := 0; i < 200; i++ {
+				if !tt.Check(state.Shape) {
+					t.Fatalf("mutation %d: %+v breaks the constraints", i, state.Shape)
+				}
+				state.Shape.Mutate()
+			}
+		})
+	}
+}
+
+// sizeConstraints returns constraints with only min_size and max_aspect
+// set.
+func sizeConstraints(minSize, maxAspect float64) Constraints {
+	return Constraints{
+		MinSize:   minSize,
+		MaxSize:   0,
+		MaxAspect: maxAspect,
+		Angles:    nil,
+		MinAngle:  0,
+		Step:      0,
+		Margin:    0,
+	}
+}
+
+func TestCheckConstraints(t *testing.T) {
+	t.Parallel()
+	ok := map[ShapeType]Constraints{ShapeTypeRectangle: sizeConstraints(100, 2)}
+	if err := CheckConstraints(ok, 128, 64); err != nil {
+		t.Errorf("got %v for constraints that fit", err)
+	}
+	for _, c := range []Constraints{sizeConstraints(200, 0), sizeConstraints(128, 1)} {
+		limits := map[ShapeType]Constraints{ShapeTypeTriangle: c}
+		if err := CheckConstraints(limits, 128, 64); err == nil {
+			t.Errorf("%+v: got no error for constraints that cannot fit", c)
+		}
+	}
+}
+
+// TestMutateGivesUp checks that mutations stop and leave the shape as it
+// was when no valid shape can be found.
+func TestMutateGivesUp(t *testing.T) {
+	t.Parallel()
+	worker := NewWorker(image.NewRGBA(image.Rect(0, 0, 32, 32)))
+	worker.Rnd = rand.New(rand.NewSource(1))
+	worker.Options.Constraints = map[ShapeType]Constraints{
+		ShapeTypeRectangle: sizeConstraints(400, 0),
+		ShapeTypeTriangle:  sizeConstraints(400, 0),
+		ShapeTypePolygon:   sizeConstraints(400, 0),
+	}
+	for _, shape := range []Shape{
+		&Rectangle{worker, 2, 2, 10, 10},
+		&Triangle{worker, 2, 2, 20, 4, 8, 20, 0},
+		&Polygon{worker, []float64{2, 20, 20, 2}, []float64{2, 2, 20, 20}, 4, false, 0},
+	} {
+		_, want := encodeShape(shape)
+		shape.Mutate()
+		if _, params := encodeShape(shape); !slices.Equal(params, want) {
+			t.Errorf("%T: mutated to %v, want %v", shape, params, want)
+		}
+		if e := worker.Energy(shape, 128); !math.IsInf(e, 1) {
+			t.Errorf("%T: got energy %v for a shape that breaks its constraints", shape, e)
+		}
+	}
+}
+
+// TestConstraintsSmallCanvas checks that shapes spawned on a canvas small
+// enough to round their random sizes down to nothing still meet min_size.
+func TestConstraintsSmallCanvas(t *testing.T) {
+	t.Parallel()
+	worker := NewWorker(image.NewRGBA(image.Rect(0, 0, 64, 64)))
+	worker.Rnd = rand.New(rand.NewSource(1))
+	worker.Options.Constraints = map[ShapeType]Constraints{
+		ShapeTypeCircle:           sizeConstraints(40, 0),
+		ShapeTypeEllipse:          sizeConstraints(40, 0),
+		ShapeTypeRotatedRectangle: sizeConstraints(40, 0),
+	}
+	for range 100 {
+		for _, shape := range []Shape{
+			NewRandomCircle(worker),
+			NewRandomEllipse(worker),
+			NewRandomRotatedRectangle(worker),
+		} {
+			if v, _ := shape.(validShape); !v.Valid() {
+				t.Fatalf("%T: spawned %+v smaller than min_size", shape, shape)
+			}
+		}
+	}
+}
+
+func TestConstraintsScale(t *testing.T) {
+	t.Parallel()
+	worker := NewWorker(image.NewRGBA(image.Rect(0, 0, 512, 256)))
+	if c := worker.constraints(ShapeTypeTriangle); c.Step != 32 || c.Margin != 32 {
+		t.Errorf("got step %v and margin %v, want 32 for a 512 pixel canvas", c.Step, c.Margin)
+	}
+	worker.StepScale = 0.5
+	if c := worker.constraints(ShapeTypeTriangle); c.Step != 16 || c.Margin != 32 {
+		t.Errorf("got step %v and margin %v, want 16 and 32 at half step scale", c.Step, c.Margin)
+	}
+	limits := DefaultConstraints(ShapeTypeTriangle)
+	limits.Step, limits.Margin = 4, 2
+	worker.Options.Constraints = map[ShapeType]Constraints{ShapeTypeTriangle: limits}
+	if c := worker.constraints(ShapeTypeTriangle); c.Step != 2 || c.Margin != 2 {
+		t.Errorf("got step %v and margin %v, want 2 and 2", c.Step, c.Margin)
+	}
+}
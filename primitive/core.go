@@ -10,19 +10,18 @@ func computeColor(target, current *image.RGBA, lines []Scanline, alpha int) Colo
 	a := 0x101 * 255 / alpha
 	for _, line := range lines {
 		i := target.PixOffset(line.X1, line.Y)
-		for x := line.X1; x <= line.X2; x++ {
-			tr := int(target.Pix[i])
-			tg := int(target.Pix[i+1])
-			tb := int(target.Pix[i+2])
-			cr := int(current.Pix[i])
-			cg := int(current.Pix[i+1])
-			cb := int(current.Pix[i+2])
-			i += 4
-			rsum += int64((tr-cr)*a + cr*0x101)
-			gsum += int64((tg-cg)*a + cg*0x101)
-			bsum += int64((tb-cb)*a + cb*0x101)
-			count++
+		n := max(line.X2-line.X1+1, 0) * 4
+		tp := target.Pix[i : i+n : i+n]
+		cp := current.Pix[i : i+n : i+n]
+		for j := 0; j+4 <= len(tp) && j+4 <= len(cp); j += 4 {
+			t := tp[j : j+4 : j+4]
+			c := cp[j : j+4 : j+4]
+			cr, cg, cb := int(c[0]), int(c[1]), int(c[2])
+			rsum += int64((int(t[0])-cr)*a + cr*0x101)
+			gsum += int64((int(t[1])-cg)*a + cg*0x101)
+			bsum += int64((int(t[2])-cb)*a + cb*0x101)
 		}
+		count += int64(n / 4)
 	}
 	if count == 0 {
 		return Color{R: 0, G: 0, B: 0, A: 0}
@@ -62,12 +61,62 @@ func drawLines(im *image.RGBA, c Color, lines []Scanline) {
 	}
 }
 
+// energyLines returns how much drawing c over current with drawLines would
+// change the sum of squared differences from target, without drawing it.
+// It composites each pixel exactly as drawLines does, so the result matches
+// differencePartial after drawLines. The pixels of each scanline are
+// resliced with constant lengths so that the compiler drops the bounds
+// checks from the loop; Go does not vectorize it further.
+func energyLines(target, current *image.RGBA, c Color, lines []Scanline) int64 {
+	const m = 0xffff
+	sr, sg, sb, sa := c.NRGBA().RGBA()
+	var total int64
+	for _, line := range lines {
+		ma := line.Alpha
+		a := (m - sa*ma/m) * 0x101
+		r, g, b, k := sr*ma, sg*ma, sb*ma, sa*ma
+		i := target.PixOffset(line.X1, line.Y)
+		n := max(line.X2-line.X1+1, 0) * 4
+		tp := target.Pix[i : i+n : i+n]
+		cp := current.Pix[i : i+n : i+n]
+		for j := 0; j+4 <= len(tp) && j+4 <= len(cp); j += 4 {
+			t := tp[j : j+4 : j+4]
+			d := cp[j : j+4 : j+4]
+			dr, dg, db, da := uint32(d[0]), uint32(d[1]), uint32(d[2]), uint32(d[3])
+			tr, tg, tb, ta := int32(t[0]), int32(t[1]), int32(t[2]), int32(t[3])
+			er1, eg1, eb1, ea1 := tr-int32(dr), tg-int32(dg), tb-int32(db), ta-int32(da)
+			er2 := tr - int32(uint8((dr*a+r)/m>>8))
+			eg2 := tg - int32(uint8((dg*a+g)/m>>8))
+			eb2 := tb - int32(uint8((db*a+b)/m>>8))
+			ea2 := ta - int32(uint8((da*a+k)/m>>8))
+			total += int64(er2*er2 + eg2*eg2 + eb2*eb2 + ea2*ea2 - (er1*er1 + eg1*eg1 + eb1*eb1 + ea1*ea1))
+		}
+	}
+	return total
+}
+
+// differenceFull returns the score of b against a: the root mean squared
+// difference of their channels, from 0 to 1.
 func differenceFull(a, b *image.RGBA) float64 {
+	size := a.Bounds().Size()
+	return errorScore(sumRows(rowErrors(a, b)), size.X, size.Y)
+}
+
+// errorScore returns the score of a w x h image whose channels' squared
+// differences sum to total.
+func errorScore(total uint64, w, h int) float64 {
+	return math.Sqrt(float64(total)/float64(w*h*4)) / 255
+}
+
+// rowErrors returns the sum of squared channel differences between a and b
+// of each row.
+func rowErrors(a, b *image.RGBA) []uint64 {
 	size := a.Bounds().Size()
 	w, h := size.X, size.Y
-	var total uint64
+	rows := make([]uint64, h)
 	for y := 0; y < h; y++ {
 		i := a.PixOffset(0, y)
+		var total uint64
 		for x := 0; x < w; x++ {
 			ar := int(a.Pix[i])
 			ag := int(a.Pix[i+1])
@@ -84,41 +133,49 @@ func differenceFull(a, b *image.RGBA) float64 {
 			da := aa - ba
 			total += uint64(dr*dr + dg*dg + db*db + da*da)
 		}
+		rows[y] = total
 	}
-	return math.Sqrt(float64(total)/float64(w*h*4)) / 255
+	return rows
 }
 
-func differencePartial(target, before, after *image.RGBA, score float64, lines []Scanline) float64 {
-	size := target.Bounds().Size()
-	w, h := size.X, size.Y
-	total := uint64(math.Pow(score*255, 2) * float64(w*h*4))
+// differencePartial returns how much the sum of squared differences from
+// target changed where the scanlines were drawn from before to after.
+func differencePartial(target, before, after *image.RGBA, lines []Scanline) int64 {
+	var total int64
 	for _, line := range lines {
-		i := target.PixOffset(line.X1, line.Y)
-		for x := line.X1; x <= line.X2; x++ {
-			tr := int(target.Pix[i])
-			tg := int(target.Pix[i+1])
-			tb := int(target.Pix[i+2])
-			ta := int(target.Pix[i+3])
-			br := int(before.Pix[i])
-			bg := int(before.Pix[i+1])
-			bb := int(before.Pix[i+2])
-			ba := int(before.Pix[i+3])
-			ar := int(after.Pix[i])
-			ag := int(after.Pix[i+1])
-			ab := int(after.Pix[i+2])
-			aa := int(after.Pix[i+3])
-			i += 4
-			dr1 := tr - br
-			dg1 := tg - bg
-			db1 := tb - bb
-			da1 := ta - ba
-			dr2 := tr - ar
-			dg2 := tg - ag
-			db2 := tb - ab
-			da2 := ta - aa
-			total -= uint64(dr1*dr1 + dg1*dg1 + db1*db1 + da1*da1)
-			total += uint64(dr2*dr2 + dg2*dg2 + db2*db2 + da2*da2)
-		}
+		total += differenceLine(target, before, after, line)
 	}
-	return math.Sqrt(float64(total)/float64(w*h*4)) / 255
+	return total
+}
+
+// differenceLine is differencePartial for a single scanline.
+func differenceLine(target, before, after *image.RGBA, line Scanline) int64 {
+	var total int64
+	i := target.PixOffset(line.X1, line.Y)
+	for x := line.X1; x <= line.X2; x++ {
+		tr := int(target.Pix[i])
+		tg := int(target.Pix[i+1])
+		tb := int(target.Pix[i+2])
+		ta := int(target.Pix[i+3])
+		br := int(before.Pix[i])
+		bg := int(before.Pix[i+1])
+		bb := int(before.Pix[i+2])
+		ba := int(before.Pix[i+3])
+		ar := int(after.Pix[i])
+		ag := int(after.Pix[i+1])
+		ab := int(after.Pix[i+2])
+		aa := int(after.Pix[i+3])
+		i += 4
+		dr1 := tr - br
+		dg1 := tg - bg
+		db1 := tb - bb
+		da1 := ta - ba
+		dr2 := tr - ar
+		dg2 := tg - ag
+		db2 := tb - ab
+		da2 := ta - aa
+		total -= int64(dr1*dr1 + dg1*dg1 + db1*db1 + da1*da1)
+		total += int64(dr2*dr2 + dg2*dg2 + db2*db2 + da2*da2)
+	}
+	return total
 }
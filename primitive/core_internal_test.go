@@ -0,0 +1,239 @@
+package primitive
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestCropScanlines(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		lines []Scanline
+		want  []Scanline
+	}{
+		{"inside", []Scanline{{2, 1, 5, 0xffff}}, []Scanline{{2, 1, 5, 0xffff}}},
+		{"above", []Scanline{{-1, 1, 5, 0xffff}}, []Scanline{}},
+		{"below", []Scanline{{10, 1, 5, 0xffff}}, []Scanline{}},
+		{"left", []Scanline{{2, -5, -1, 0xffff}}, []Scanline{}},
+		{"right", []Scanline{{2, 10, 12, 0xffff}}, []Scanline{}},
+		{"clamped", []Scanline{{2, -3, 12, 0x8000}}, []Scanline{{2, 0, 9, 0x8000}}},
+		{"edges", []Scanline{{0, 0, 0, 0xffff}, {9, 9, 9, 0xffff}}, []Scanline{{0, 0, 0, 0xffff}, {9, 9, 9, 0xffff}}},
+		{"reversed", []Scanline{{2, 5, 1, 0xffff}}, []Scanline{}},
+		{"mixed", []Scanline{{-1, 0, 3, 0xffff}, {1, 0, 3, 0xffff}, {11, 0, 3, 0xffff}, {3, 8, 20, 0xffff}}, []Scanline{{1, 0, 3, 0xffff}, {3, 8, 9, 0xffff}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := cropScanlines(tt.lines, 10, 10)
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func fullLines(w, h int) []Scanline {
+	lines := make([]Scanline, h)
+	for y := range lines {
+		lines[y] = Scanline{y, 0, w - 1, 0xffff}
+	}
+	return lines
+}
+
+func TestComputeColor(t *testing.T) {
+	t.Parallel()
+	bounds := image.Rect(0, 0, 8, 8)
+	current := uniformRGBA(bounds, color.NRGBA{200, 100, 50, 255})
+	tests := []struct {
+		name   string
+		target color.NRGBA
+		alpha  int
+	}{
+		{"opaque", color.NRGBA{10, 20, 30, 255}, 255},
+		{"same", color.NRGBA{200, 100, 50, 255}, 128},
+		{"half", color.NRGBA{100, 150, 250, 255}, 128},
+		{"clamped", color.NRGBA{255, 0, 255, 255}, 32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			target := uniformRGBA(bounds, tt.target)
+			lines := fullLines(8, 8)
+			c := computeColor(target, current, lines, tt.alpha)
+			if c.A != tt.alpha {
+				t.Fatalf("alpha = %d, want %d", c.A, tt.alpha)
+			}
+			// drawing the computed color must get as close to the target as
+			// any color can at this alpha
+			im := copyRGBA(current)
+			drawLines(im, c, lines)
+			got := differenceFull(target, im)
+			for _, d := range []Color{{c.R + 1, c.G, c.B, c.A}, {c.R - 1, c.G, c.B, c.A}, {c.R, c.G + 1, c.B, c.A}, {c.R, c.G, c.B - 1, c.A}} {
+				if d.R < 0 || d.G < 0 || d.B < 0 || d.R > 255 || d.G > 255 || d.B > 255 {
+					continue
+				}
+				im := copyRGBA(current)
+				drawLines(im, d, lines)
+				if e := differenceFull(target, im); e < got-1e-3 {
+					t.Errorf("color %v scores %f, but %v scores %f", c, got, d, e)
+				}
+			}
+		})
+	}
+	t.Run("empty", func(t *testing.T) {
+		t.Parallel()
+		c := computeColor(current, current, nil, 128)
+		if c != (Color{0, 0, 0, 0}) {
+			t.Errorf("got %v, want transparent black", c)
+		}
+	})
+}
+
+func TestDifferencePartial(t *testing.T) {
+	t.Parallel()
+	const w, h = 48, 32
+	rnd := rand.New(rand.NewSource(1))
+	target := image.NewRGBA(image.Rect(0, 0, w, h))
+	rnd.Read(target.Pix)
+	current := uniformRGBA(target.Bounds(), color.NRGBA{128, 128, 128, 255})
+	worker := NewWorker(target)
+	worker.Rnd = rnd
+	total := sumRows(rowErrors(target, current))
+	for i := 0; i < 50; i++ {
+		state := worker.RandomState(ShapeTypeAny, 128)
+		lines := state.Shape.Rasterize()
+		c := computeColor(target, current, lines, state.Alpha)
+		after := copyRGBA(current)
+		drawLines(after, c, lines)
+		partial := uint64(int64(total) + differencePartial(target, current, after, lines))
+		full := sumRows(rowErrors(target, after))
+		if partial != full {
+			t.Fatalf("shape %d: partial %d, full %d", i, partial, full)
+		}
+		if got, want := errorScore(full, w, h), differenceFull(target, after); got != want {
+			t.Fatalf("shape %d: score %f, want %f", i, got, want)
+		}
+		current, total = after, full
+	}
+}
+
+// TestModelErrorTotal checks that adding shapes keeps the model's error
+// totals exact, and that checkError catches a canvas changed behind them.
+func TestModelErrorTotal(t *testing.T) {
+	t.Parallel()
+	const w, h = 48, 32
+	rnd := rand.New(rand.NewSource(1))
+	im := image.NewRGBA(image.Rect(0, 0, w, h))
+	rnd.Read(im.Pix)
+	for i := 3; i < len(im.Pix); i += 4 {
+		im.Pix[i] = 255
+	}
+	model := NewModel(im, &Color{R: 0, G: 0, B: 0, A: 255}, w, 1)
+	worker := model.Workers[0]
+	worker.Rnd = rnd
+	worker.Init(model.Current, model.Total)
+	for range 100 {
+		state := worker.RandomState(ShapeTypeAny, rnd.Intn(255)+1)
+		model.Add(state.Shape, state.Alpha)
+	}
+	if want := sumRows(rowErrors(model.Target, model.Current)); model.Total != want {
+		t.Fatalf("total is %d, want %d", model.Total, want)
+	}
+	if want := differenceFull(model.Target, model.Current); model.Score != want {
+		t.Errorf("score is %f, want %f", model.Score, want)
+	}
+	if got, want := model.RowError(0, 10)+model.RowError(10, h), model.Total; got != want {
+		t.Errorf("rows sum to %d, want %d", got, want)
+	}
+	if !model.checkError() {
+		t.Errorf("checkError found a drift in exact totals")
+	}
+	model.Current.Pix[model.Current.PixOffset(5, 7)] ^= 0xff
+	if model.checkError() {
+		t.Errorf("checkError missed a changed pixel")
+	}
+	if want := sumRows(rowErrors(model.Target, model.Current)); model.Total != want {
+		t.Errorf("total is %d after the check, want %d", model.Total, want)
+	}
+}
+
+// TestEnergyLines checks that the fused kernel scores shapes exactly as
+// drawing them into the buffer and calling differencePartial does.
+func TestEnergyLines(t *testing.T) {
+	t.Parallel()
+	const w, h = 48, 32
+	rnd := rand.New(rand.NewSource(1))
+	target := image.NewRGBA(image.Rect(0, 0, w, h))
+	rnd.Read(target.Pix)
+	current := image.NewRGBA(target.Bounds())
+	rnd.Read(current.Pix)
+	worker := NewWorker(target)
+	worker.Rnd = rnd
+	worker.Init(current, sumRows(rowErrors(target, current)))
+	for i := 0; i < 200; i++ {
+		state := worker.RandomState(ShapeTypeAny, rnd.Intn(255)+1)
+		lines := state.Shape.Rasterize()
+		c := computeColor(target, current, lines, state.Alpha)
+		after := copyRGBA(current)
+		drawLines(after, c, lines)
+		want := worker.score(differencePartial(target, current, after, lines))
+		if got := worker.Energy(state.Shape, state.Alpha); got != want {
+			t.Fatalf("shape %d: got %v, want %v", i, got, want)
+		}
+	}
+}
+
+func BenchmarkEnergyLines(b *testing.B) {
+	const w, h = 128, 128
+	rnd := rand.New(rand.NewSource(1))
+	target := image.NewRGBA(image.Rect(0, 0, w, h))
+	rnd.Read(target.Pix)
+	current := uniformRGBA(target.Bounds(), color.NRGBA{128, 128, 128, 255})
+	buffer := copyRGBA(current)
+	lines := fullLines(64, 64)
+	c := computeColor(target, current, lines, 128)
+	b.Run("separate", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			copyLines(buffer, current, lines)
+			drawLines(buffer, c, lines)
+			differencePartial(target, current, buffer, lines)
+		}
+	})
+	b.Run("fused", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			energyLines(target, current, c, lines)
+		}
+	})
+}
+
+// unknownShape is a shape that is not one of the built-in types.
+type unknownShape struct {
+	Triangle
+}
+
+func (s *unknownShape) Copy() Shape {
+	a := *s
+	return &a
+}
+
+// TestRenderUnknownShape checks that native rendering refuses shapes of
+// other types instead of crashing, while gg still draws them.
+func TestRenderUnknownShape(t *testing.T) {
+	t.Parallel()
+	model := NewModel(image.NewRGBA(image.Rect(0, 0, 32, 32)), &Color{R: 0, G: 0, B: 0, A: 255}, 32, 1)
+	defer model.Close()
+	model.Add(&unknownShape{Triangle{model.Workers[0], 2, 3, 20, 5, 10, 25, 0}}, 128)
+	if _, err := model.Render(64, RenderOptions{Supersample: 1, Native: true}); err == nil {
+		t.Error("native Render: got no error")
+	}
+	if _, err := model.Render(64, RenderOptions{Supersample: 1, Native: false}); err != nil {
+		t.Errorf("Render: %v", err)
+	}
+}
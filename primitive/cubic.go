@@ -0,0 +1,224 @@
+package primitive
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/raster"
+)
+
+type Cubic struct {
+	Worker *Worker
+	X1, Y1 float64
+	X2, Y2 float64
+	X3, Y3 float64
+	X4, Y4 float64
+	Width  float64
+}
+
+func NewRandomCubic(worker *Worker) *Cubic {
+	rnd := worker.Rnd
+	s := worker.spawnScale()
+	x1 := rnd.Float64() * float64(worker.W)
+	y1 := rnd.Float64() * float64(worker.H)
+	x2 := x1 + (rnd.Float64()*40-20)*s
+	y2 := y1 + (rnd.Float64()*40-20)*s
+	x3 := x2 + (rnd.Float64()*40-20)*s
+	y3 := y2 + (rnd.Float64()*40-20)*s
+	x4 := x3 + (rnd.Float64()*40-20)*s
+	y4 := y3 + (rnd.Float64()*40-20)*s
+	width := 1.0 / 2
+	c := &Cubic{worker, x1, y1, x2, y2, x3, y3, x4, y4, width}
+	c.Mutate()
+	return c
+}
+
+func (c *Cubic) Draw(dc *gg.Context, scale float64) {
+	dc.MoveTo(c.X1, c.Y1)
+	dc.CubicTo(c.X2, c.Y2, c.X3, c.Y3, c.X4, c.Y4)
+	dc.SetLineWidth(c.Width * scale)
+	dc.Stroke()
+}
+
+func (c *Cubic) SVG(attrs string) string {
+	attrs = strings.Replace(attrs, "fill", "stroke", -1)
+	return fmt.Sprintf(
+		"<path %s fill=\"none\" d=\"M %f %f C %f %f, %f %f, %f %f\" stroke-width=\"%f\" />",
+		attrs, c.X1, c.Y1, c.X2, c.Y2, c.X3, c.Y3, c.X4, c.Y4, c.Width)
+}
+
+func (c *Cubic) Copy() Shape {
+	a := *c
+	return &a
+}
+
+func (c *Cubic) Mutate() {
+	w := c.Worker.W
+	h := c.Worker.H
+	rnd := c.Worker.Rnd
+	limits := c.Worker.constraints(ShapeTypeCubic)
+	m := limits.Margin
+	saved := *c
+	for range mutateTries {
+		switch rnd.Intn(5) {
+		case 0:
+			c.X1 = clamp(c.X1+rnd.NormFloat64()*limits.Step, -m, float64(w-1)+m)
+			c.Y1 = clamp(c.Y1+rnd.NormFloat64()*limits.Step, -m, float64(h-1)+m)
+		case 1:
+			c.X2 = clamp(c.X2+rnd.NormFloat64()*limits.Step, -m, float64(w-1)+m)
+			c.Y2 = clamp(c.Y2+rnd.NormFloat64()*limits.Step, -m, float64(h-1)+m)
+		case 2:
+			c.X3 = clamp(c.X3+rnd.NormFloat64()*limits.Step, -m, float64(w-1)+m)
+			c.Y3 = clamp(c.Y3+rnd.NormFloat64()*limits.Step, -m, float64(h-1)+m)
+		case 3:
+			c.X4 = clamp(c.X4+rnd.NormFloat64()*limits.Step, -m, float64(w-1)+m)
+			c.Y4 = clamp(c.Y4+rnd.NormFloat64()*limits.Step, -m, float64(h-1)+m)
+		case 4:
+			k := c.Worker.canvasScale()
+			c.Width = clamp(c.Width+rnd.NormFloat64()*k, 1, 16*k)
+		}
+		if c.Valid() {
+			return
+		}
+	}
+	*c = saved
+}
+
+// Valid rejects curves whose control points reach further than the
+// distance between the end points, which would fold the stroke back on
+// itself, and curves that break their size and aspect constraints.
+func (c *Cubic) Valid() bool {
+	limits := c.Worker.constraints(ShapeTypeCubic)
+	if !limits.fitsPoints([]float64{c.X1, c.X2, c.X3, c.X4}, []float64{c.Y1, c.Y2, c.Y3, c.Y4}) {
+		return false
+	}
+	dx12 := int(c.X1 - c.X2)
+	dy12 := int(c.Y1 - c.Y2)
+	dx34 := int(c.X3 - c.X4)
+	dy34 := int(c.Y3 - c.Y4)
+	dx14 := int(c.X1 - c.X4)
+	dy14 := int(c.Y1 - c.Y4)
+	d12 := dx12*dx12 + dy12*dy12
+	d34 := dx34*dx34 + dy34*dy34
+	d14 := dx14*dx14 + dy14*dy14
+	return d14 > d12 && d14 > d34
+}
+
+func (c *Cubic) Rasterize() []Scanline {
+	var path raster.Path
+	path.Start(fixp(c.X1, c.Y1))
+	addCubic(&path, c.X1, c.Y1, c.X2, c.Y2, c.X3, c.Y3, c.X4, c.Y4, 8)
+	width := fix(c.Width)
+	return strokePath(c.Worker, path, width, raster.RoundCapper, raster.RoundJoiner)
+}
+
+// Blob is a closed, filled curve through its points. Each pair of
+// neighbouring points is joined by a cubic segment whose control points
+// are derived from the points either side (a closed Catmull-Rom spline),
+// so the outline stays smooth however the points move.
+type Blob struct {
+	Worker *Worker
+	X      []float64
+	Y      []float64
+	Order  int
+}
+
+func NewRandomBlob(worker *Worker, order int) *Blob {
+	rnd := worker.Rnd
+	s := worker.spawnScale()
+	x := make([]float64, order)
+	y := make([]float64, order)
+	cx := rnd.Float64() * float64(worker.W)
+	cy := rnd.Float64() * float64(worker.H)
+	for i := 0; i < order; i++ {
+		a := (float64(i) + rnd.Float64()*0.5) * 2 * math.Pi / float64(order)
+		r := (rnd.Float64()*16 + 4) * s
+		x[i] = cx + math.Cos(a)*r
+		y[i] = cy + math.Sin(a)*r
+	}
+	b := &Blob{Worker: worker, X: x, Y: y, Order: order}
+	b.Mutate()
+	return b
+}
+
+// segment returns the control points of the cubic from point i to i+1.
+func (b *Blob) segment(i int) (x1, y1, x2, y2 float64) {
+	n := b.Order
+	h := (i + n - 1) % n
+	j := (i + 1) % n
+	k := (i + 2) % n
+	x1 = b.X[i] + (b.X[j]-b.X[h])/6
+	y1 = b.Y[i] + (b.Y[j]-b.Y[h])/6
+	x2 = b.X[j] - (b.X[k]-b.X[i])/6
+	y2 = b.Y[j] - (b.Y[k]-b.Y[i])/6
+	return
+}
+
+func (b *Blob) Draw(dc *gg.Context, scale float64) {
+	dc.NewSubPath()
+	dc.MoveTo(b.X[0], b.Y[0])
+	for i := 0; i < b.Order; i++ {
+		j := (i + 1) % b.Order
+		x1, y1, x2, y2 := b.segment(i)
+		dc.CubicTo(x1, y1, x2, y2, b.X[j], b.Y[j])
+	}
+	dc.ClosePath()
+	dc.Fill()
+}
+
+func (b *Blob) SVG(attrs string) string {
+	segments := make([]string, b.Order)
+	for i := 0; i < b.Order; i++ {
+		j := (i + 1) % b.Order
+		x1, y1, x2, y2 := b.segment(i)
+		segments[i] = fmt.Sprintf("C %f %f, %f %f, %f %f", x1, y1, x2, y2, b.X[j], b.Y[j])
+	}
+	return fmt.Sprintf(
+		"<path %s d=\"M %f %f %s Z\" />",
+		attrs, b.X[0], b.Y[0], strings.Join(segments, " "))
+}
+
+func (b *Blob) Copy() Shape {
+	a := *b
+	a.X = make([]float64, b.Order)
+	a.Y = make([]float64, b.Order)
+	copy(a.X, b.X)
+	copy(a.Y, b.Y)
+	return &a
+}
+
+func (b *Blob) Mutate() {
+	w := b.Worker.W
+	h := b.Worker.H
+	rnd := b.Worker.Rnd
+	limits := b.Worker.constraints(ShapeTypeBlob)
+	m := limits.Margin
+	saved, _ := b.Copy().(*Blob)
+	for range mutateTries {
+		i := rnd.Intn(b.Order)
+		b.X[i] = clamp(b.X[i]+rnd.NormFloat64()*limits.Step, -m, float64(w-1)+m)
+		b.Y[i] = clamp(b.Y[i]+rnd.NormFloat64()*limits.Step, -m, float64(h-1)+m)
+		if b.Valid() {
+			return
+		}
+	}
+	*b = *saved
+}
+
+// Valid checks the blob against its size and aspect constraints.
+func (b *Blob) Valid() bool {
+	return b.Worker.constraints(ShapeTypeBlob).fitsPoints(b.X, b.Y)
+}
+
+func (b *Blob) Rasterize() []Scanline {
+	var path raster.Path
+	path.Start(fixp(b.X[0], b.Y[0]))
+	for i := 0; i < b.Order; i++ {
+		j := (i + 1) % b.Order
+		x1, y1, x2, y2 := b.segment(i)
+		path.Add3(fixp(x1, y1), fixp(x2, y2), fixp(b.X[j], b.Y[j]))
+	}
+	return fillPath(b.Worker, path)
+}
@@ -5,36 +5,37 @@ import (
 	"math"
 
 	"github.com/fogleman/gg"
-	"github.com/golang/freetype/raster"
 )
 
 type Ellipse struct {
-	Worker *Worker
-	X, Y   int
-	Rx, Ry int
-	Circle bool
+	Worker  *Worker
+	X, Y    int
+	Rx, Ry  int
+	Circle  bool
+	Outline float64
 }
 
 func NewRandomEllipse(worker *Worker) *Ellipse {
 	rnd := worker.Rnd
 	x := rnd.Intn(worker.W)
 	y := rnd.Intn(worker.H)
-	rx := rnd.Intn(32) + 1
-	ry := rnd.Intn(32) + 1
-	return &Ellipse{worker, x, y, rx, ry, false}
+	rx, ry := worker.constraints(ShapeTypeEllipse).fitRadii(worker.spawnInt(rnd.Intn(32)+1), worker.spawnInt(rnd.Intn(32)+1))
+	return &Ellipse{worker, x, y, rx, ry, false, worker.Options.Outline}
 }
 
 func NewRandomCircle(worker *Worker) *Ellipse {
 	rnd := worker.Rnd
 	x := rnd.Intn(worker.W)
 	y := rnd.Intn(worker.H)
-	r := rnd.Intn(32) + 1
-	return &Ellipse{worker, x, y, r, r, true}
+	r, _ := worker.constraints(ShapeTypeCircle).fitRadii(worker.spawnInt(rnd.Intn(32)+1), 0)
+	return &Ellipse{worker, x, y, r, r, true, worker.Options.Outline}
 }
 
 func (c *Ellipse) Draw(dc *gg.Context, scale float64) {
+	dc.Push()
 	dc.DrawEllipse(float64(c.X), float64(c.Y), float64(c.Rx), float64(c.Ry))
-	dc.Fill()
+	fillOrStroke(dc, c.Outline, scale)
+	dc.Pop()
 }
 
 func (c *Ellipse) SVG(attrs string) string {
@@ -43,6 +44,10 @@ func (c *Ellipse) SVG(attrs string) string {
 		attrs, c.X, c.Y, c.Rx, c.Ry)
 }
 
+func (c *Ellipse) outlineWidth() float64 {
+	return c.Outline
+}
+
 func (c *Ellipse) Copy() Shape {
 	a := *c
 	return &a
@@ -52,24 +57,37 @@ func (c *Ellipse) Mutate() {
 	w := c.Worker.W
 	h := c.Worker.H
 	rnd := c.Worker.Rnd
+	limits := c.Worker.constraints(shapeTypeOf(c))
 	switch rnd.Intn(3) {
 	case 0:
-		c.X = clampInt(c.X+int(rnd.NormFloat64()*16), 0, w-1)
-		c.Y = clampInt(c.Y+int(rnd.NormFloat64()*16), 0, h-1)
+		c.X = clampInt(c.X+int(rnd.NormFloat64()*limits.Step), 0, w-1)
+		c.Y = clampInt(c.Y+int(rnd.NormFloat64()*limits.Step), 0, h-1)
 	case 1:
-		c.Rx = clampInt(c.Rx+int(rnd.NormFloat64()*16), 1, w-1)
+		c.Rx = clampInt(c.Rx+int(rnd.NormFloat64()*limits.Step), 1, w-1)
 		if c.Circle {
 			c.Ry = c.Rx
 		}
+		c.Rx, c.Ry = limits.fitRadii(c.Rx, c.Ry)
 	case 2:
-		c.Ry = clampInt(c.Ry+int(rnd.NormFloat64()*16), 1, h-1)
+		c.Ry = clampInt(c.Ry+int(rnd.NormFloat64()*limits.Step), 1, h-1)
 		if c.Circle {
 			c.Rx = c.Ry
 		}
+		c.Ry, c.Rx = limits.fitRadii(c.Ry, c.Rx)
 	}
 }
 
+// Valid checks the ellipse against its size and aspect constraints, which
+// whole pixel radii may not meet exactly.
+func (c *Ellipse) Valid() bool {
+	return c.Worker.constraints(shapeTypeOf(c)).fits(float64(2*c.Rx), float64(2*c.Ry))
+}
+
 func (c *Ellipse) Rasterize() []Scanline {
+	if c.Outline > 0 {
+		path := ellipsePath(float64(c.X), float64(c.Y), float64(c.Rx), float64(c.Ry), 0)
+		return strokeOutline(c.Worker, path, c.Outline)
+	}
 	w := c.Worker.W
 	h := c.Worker.H
 	lines := c.Worker.Lines[:0]
@@ -100,36 +118,56 @@ func (c *Ellipse) Rasterize() []Scanline {
 }
 
 type RotatedEllipse struct {
-	Worker *Worker
-	X, Y   float64
-	Rx, Ry float64
-	Angle  float64
+	Worker  *Worker
+	X, Y    float64
+	Rx, Ry  float64
+	Angle   float64
+	Outline float64
 }
 
 func NewRandomRotatedEllipse(worker *Worker) *RotatedEllipse {
 	rnd := worker.Rnd
 	x := rnd.Float64() * float64(worker.W)
 	y := rnd.Float64() * float64(worker.H)
-	rx := rnd.Float64()*32 + 1
-	ry := rnd.Float64()*32 + 1
-	a := rnd.Float64() * 360
-	return &RotatedEllipse{worker, x, y, rx, ry, a}
+	limits := worker.constraints(ShapeTypeRotatedEllipse)
+	s := worker.spawnScale()
+	d1, d2 := limits.fit((rnd.Float64()*32+1)*s*2, (rnd.Float64()*32+1)*s*2)
+	a := limits.snapAngle(rnd.Float64() * 360)
+	return &RotatedEllipse{worker, x, y, d1 / 2, d2 / 2, a, worker.Options.Outline}
 }
 
 func (c *RotatedEllipse) Draw(dc *gg.Context, scale float64) {
 	dc.Push()
 	dc.RotateAbout(radians(c.Angle), c.X, c.Y)
 	dc.DrawEllipse(c.X, c.Y, c.Rx, c.Ry)
-	dc.Fill()
+	fillOrStroke(dc, c.Outline, scale)
 	dc.Pop()
 }
 
+// SVG draws a unit circle scaled to the ellipse, or for an outline, whose
+// stroke would be scaled with it, the ellipse itself.
 func (c *RotatedEllipse) SVG(attrs string) string {
+	if c.Outline > 0 {
+		return fmt.Sprintf(
+			"<g transform=\"translate(%f %f) rotate(%f)\"><ellipse %s cx=\"0\" cy=\"0\" rx=\"%f\" ry=\"%f\" /></g>",
+			c.X, c.Y, c.Angle, attrs, c.Rx, c.Ry)
+	}
 	return fmt.Sprintf(
 		"<g transform=\"translate(%f %f) rotate(%f) scale(%f %f)\"><ellipse %s cx=\"0\" cy=\"0\" rx=\"1\" ry=\"1\" /></g>",
 		c.X, c.Y, c.Angle, c.Rx, c.Ry, attrs)
 }
 
+func (c *RotatedEllipse) svgTransform() (x, y, angle, sx, sy float64) {
+	if c.Outline > 0 {
+		return c.X, c.Y, c.Angle, 1, 1
+	}
+	return c.X, c.Y, c.Angle, c.Rx, c.Ry
+}
+
+func (c *RotatedEllipse) outlineWidth() float64 {
+	return c.Outline
+}
+
 func (c *RotatedEllipse) Copy() Shape {
 	a := *c
 	return &a
@@ -139,41 +177,25 @@ func (c *RotatedEllipse) Mutate() {
 	w := c.Worker.W
 	h := c.Worker.H
 	rnd := c.Worker.Rnd
+	limits := c.Worker.constraints(ShapeTypeRotatedEllipse)
 	switch rnd.Intn(3) {
 	case 0:
-		c.X = clamp(c.X+rnd.NormFloat64()*16, 0, float64(w-1))
-		c.Y = clamp(c.Y+rnd.NormFloat64()*16, 0, float64(h-1))
+		c.X = clamp(c.X+rnd.NormFloat64()*limits.Step, 0, float64(w-1))
+		c.Y = clamp(c.Y+rnd.NormFloat64()*limits.Step, 0, float64(h-1))
 	case 1:
-		c.Rx = clamp(c.Rx+rnd.NormFloat64()*16, 1, float64(w-1))
-		c.Ry = clamp(c.Ry+rnd.NormFloat64()*16, 1, float64(w-1))
+		c.Rx = clamp(c.Rx+rnd.NormFloat64()*limits.Step, 1, float64(w-1))
+		c.Ry = clamp(c.Ry+rnd.NormFloat64()*limits.Step, 1, float64(w-1))
+		d1, d2 := limits.fit(c.Rx*2, c.Ry*2)
+		c.Rx, c.Ry = d1/2, d2/2
 	case 2:
-		c.Angle = c.Angle + rnd.NormFloat64()*32
+		c.Angle = limits.mutateAngle(rnd, c.Angle)
 	}
 }
 
 func (c *RotatedEllipse) Rasterize() []Scanline {
-	var path raster.Path
-	const n = 16
-	for i := 0; i < n; i++ {
-		p1 := float64(i+0) / n
-		p2 := float64(i+1) / n
-		a1 := p1 * 2 * math.Pi
-		a2 := p2 * 2 * math.Pi
-		x0 := c.Rx * math.Cos(a1)
-		y0 := c.Ry * math.Sin(a1)
-		x1 := c.Rx * math.Cos(a1+(a2-a1)/2)
-		y1 := c.Ry * math.Sin(a1+(a2-a1)/2)
-		x2 := c.Rx * math.Cos(a2)
-		y2 := c.Ry * math.Sin(a2)
-		cx := 2*x1 - x0/2 - x2/2
-		cy := 2*y1 - y0/2 - y2/2
-		x0, y0 = rotate(x0, y0, radians(c.Angle))
-		cx, cy = rotate(cx, cy, radians(c.Angle))
-		x2, y2 = rotate(x2, y2, radians(c.Angle))
-		if i == 0 {
-			path.Start(fixp(x0+c.X, y0+c.Y))
-		}
-		path.Add2(fixp(cx+c.X, cy+c.Y), fixp(x2+c.X, y2+c.Y))
+	path := ellipsePath(c.X, c.Y, c.Rx, c.Ry, c.Angle)
+	if c.Outline > 0 {
+		return strokeOutline(c.Worker, path, c.Outline)
 	}
 	return fillPath(c.Worker, path)
 }
@@ -0,0 +1,271 @@
+package primitive
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/raster"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Font is a TrueType font and the characters of it that glyph shapes may
+// use. Glyph outlines are parsed once and shared by every shape.
+type Font struct {
+	font     *truetype.Font
+	outlines map[rune]*glyphOutline
+	Glyphs   []rune
+	mu       sync.Mutex
+}
+
+// ParseFont parses a TrueType font. glyphs lists the characters random
+// glyph shapes are drawn from; every one must be in the font.
+func ParseFont(ttf []byte, glyphs string) (*Font, error) {
+	tf, err := truetype.Parse(ttf)
+	if err != nil {
+		return nil, err
+	}
+	f := &Font{
+		font:     tf,
+		outlines: make(map[rune]*glyphOutline),
+		Glyphs:   nil,
+		mu:       sync.Mutex{},
+	}
+	for _, r := range glyphs {
+		if _, err := f.outline(r); err != nil {
+			return nil, err
+		}
+		f.Glyphs = append(f.Glyphs, r)
+	}
+	return f, nil
+}
+
+func LoadFont(path, glyphs string) (*Font, error) {
+	ttf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFont(ttf, glyphs)
+}
+
+// glyphOutline is a glyph's contours in ems, centered on its bounding box
+// with y pointing down.
+type glyphOutline struct {
+	Contours [][]glyphSegment
+}
+
+// glyphSegment is a line to P, or a quadratic curve through C to P.
+type glyphSegment struct {
+	Quadratic bool
+	CX, CY    float64
+	PX, PY    float64
+}
+
+func (f *Font) outline(r rune) (*glyphOutline, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if o, ok := f.outlines[r]; ok {
+		return o, nil
+	}
+	index := f.font.Index(r)
+	if index == 0 {
+		return nil, fmt.Errorf("font has no glyph for %q", r)
+	}
+	em := f.font.FUnitsPerEm()
+	var g truetype.GlyphBuf
+	if err := g.Load(f.font, fixed.I(int(em)), index, font.HintingNone); err != nil {
+		return nil, err
+	}
+	// points are in 26.6 units of 1/em; convert to ems around the center
+	unit := 64 * float64(em)
+	cx := float64(g.Bounds.Min.X+g.Bounds.Max.X) / 2 / unit
+	cy := float64(g.Bounds.Min.Y+g.Bounds.Max.Y) / 2 / unit
+	point := func(p truetype.Point) (x, y float64) {
+		return float64(p.X)/unit - cx, cy - float64(p.Y)/unit
+	}
+	o := &glyphOutline{Contours: nil}
+	start := 0
+	for _, end := range g.Ends {
+		ps := g.Points[start:end]
+		start = end
+		if len(ps) == 0 {
+			continue
+		}
+		// see freetype.Context.drawContour: two consecutive off-curve
+		// points imply an on-curve point between them
+		var contour []glyphSegment
+		on := func(p truetype.Point) bool {
+			return p.Flags&0x01 != 0
+		}
+		sx, sy := point(ps[0])
+		others := ps[1:]
+		if !on(ps[0]) {
+			lx, ly := point(ps[len(ps)-1])
+			if on(ps[len(ps)-1]) {
+				sx, sy = lx, ly
+				others = ps[:len(ps)-1]
+			} else {
+				sx, sy = (sx+lx)/2, (sy+ly)/2
+				others = ps
+			}
+		}
+		contour = append(contour, glyphSegment{false, 0, 0, sx, sy})
+		qx, qy, on0 := sx, sy, true
+		for _, p := range others {
+			x, y := point(p)
+			switch {
+			case on(p) && on0:
+				contour = append(contour, glyphSegment{false, 0, 0, x, y})
+			case on(p):
+				contour = append(contour, glyphSegment{true, qx, qy, x, y})
+			case !on0:
+				contour = append(contour, glyphSegment{true, qx, qy, (qx + x) / 2, (qy + y) / 2})
+			}
+			qx, qy, on0 = x, y, on(p)
+		}
+		if on0 {
+			contour = append(contour, glyphSegment{false, 0, 0, sx, sy})
+		} else {
+			contour = append(contour, glyphSegment{true, qx, qy, sx, sy})
+		}
+		o.Contours = append(o.Contours, contour)
+	}
+	f.outlines[r] = o
+	return o, nil
+}
+
+// Glyph is a character of a font, centered on X, Y, Size pixels to the em
+// and rotated by Angle degrees.
+type Glyph struct {
+	Worker  *Worker
+	Font    *Font
+	outline *glyphOutline
+	Rune    rune
+	X, Y    float64
+	Size    float64
+	Angle   float64
+}
+
+// NewGlyph returns a glyph shape for r, which must be in the font.
+func NewGlyph(worker *Worker, f *Font, r rune, x, y, size, angle float64) (*Glyph, error) {
+	o, err := f.outline(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Glyph{worker, f, o, r, x, y, size, angle}, nil
+}
+
+func NewRandomGlyph(worker *Worker) *Glyph {
+	rnd := worker.Rnd
+	f := worker.Options.Font
+	r := f.Glyphs[rnd.Intn(len(f.Glyphs))]
+	o, _ := f.outline(r) // the font has already loaded every glyph
+	x := rnd.Float64() * float64(worker.W)
+	y := rnd.Float64() * float64(worker.H)
+	limits := worker.constraints(ShapeTypeGlyph)
+	size, _ := limits.fit((rnd.Float64()*24+8)*worker.spawnScale(), 0)
+	angle := limits.snapAngle(rnd.NormFloat64() * 15)
+	g := &Glyph{worker, f, o, r, x, y, size, angle}
+	g.Mutate()
+	return g
+}
+
+// path calls moveTo, lineTo and quadTo with the outline in image space.
+func (g *Glyph) path(moveTo, lineTo func(x, y float64), quadTo func(x1, y1, x2, y2 float64)) {
+	theta := radians(g.Angle)
+	t := func(u, v float64) (x, y float64) {
+		x, y = rotate(u*g.Size, v*g.Size, theta)
+		return x + g.X, y + g.Y
+	}
+	for _, contour := range g.outline.Contours {
+		for i, s := range contour {
+			px, py := t(s.PX, s.PY)
+			switch {
+			case i == 0:
+				moveTo(px, py)
+			case s.Quadratic:
+				cx, cy := t(s.CX, s.CY)
+				quadTo(cx, cy, px, py)
+			default:
+				lineTo(px, py)
+			}
+		}
+	}
+}
+
+func (g *Glyph) Draw(dc *gg.Context, scale float64) {
+	g.path(dc.MoveTo, dc.LineTo, dc.QuadraticTo)
+	dc.ClosePath()
+	dc.Fill()
+}
+
+// SVG writes the glyph as an outlined path, so the output does not depend
+// on the font being installed. The character is kept in data-glyph.
+func (g *Glyph) SVG(attrs string) string {
+	d := new(strings.Builder)
+	for _, contour := range g.outline.Contours {
+		for i, s := range contour {
+			switch {
+			case i == 0:
+				fmt.Fprintf(d, "M %f %f ", s.PX, s.PY)
+			case s.Quadratic:
+				fmt.Fprintf(d, "Q %f %f, %f %f ", s.CX, s.CY, s.PX, s.PY)
+			default:
+				fmt.Fprintf(d, "L %f %f ", s.PX, s.PY)
+			}
+		}
+		d.WriteString("Z ")
+	}
+	return fmt.Sprintf(
+		"<g transform=\"translate(%f %f) rotate(%f) scale(%f %f)\"><path %s data-glyph=\"%s\" d=\"%s\" /></g>",
+		g.X, g.Y, g.Angle, g.Size, g.Size, attrs, html.EscapeString(string(g.Rune)), strings.TrimSpace(d.String()))
+}
+
+func (g *Glyph) svgTransform() (x, y, angle, sx, sy float64) {
+	return g.X, g.Y, g.Angle, g.Size, g.Size
+}
+
+func (g *Glyph) Copy() Shape {
+	a := *g
+	return &a
+}
+
+func (g *Glyph) Mutate() {
+	w := g.Worker.W
+	h := g.Worker.H
+	rnd := g.Worker.Rnd
+	limits := g.Worker.constraints(ShapeTypeGlyph)
+	m := limits.Margin
+	switch rnd.Intn(4) {
+	case 0:
+		g.X = clamp(g.X+rnd.NormFloat64()*limits.Step, -m, float64(w-1)+m)
+		g.Y = clamp(g.Y+rnd.NormFloat64()*limits.Step, -m, float64(h-1)+m)
+	case 1:
+		g.Size = clamp(g.Size+rnd.NormFloat64()*limits.Step/2, 4, float64(maxInt(w, h)))
+		g.Size, _ = limits.fit(g.Size, g.Size)
+	case 2:
+		g.Angle = limits.mutateAngle(rnd, g.Angle)
+	case 3:
+		if len(g.Font.Glyphs) > 1 {
+			g.Rune = g.Font.Glyphs[rnd.Intn(len(g.Font.Glyphs))]
+			g.outline, _ = g.Font.outline(g.Rune)
+		}
+	}
+}
+
+func (g *Glyph) Rasterize() []Scanline {
+	var path raster.Path
+	g.path(func(x, y float64) {
+		path.Start(fixp(x, y))
+	}, func(x, y float64) {
+		path.Add1(fixp(x, y))
+	}, func(x1, y1, x2, y2 float64) {
+		path.Add2(fixp(x1, y1), fixp(x2, y2))
+	})
+	return fillPath(g.Worker, path)
+}
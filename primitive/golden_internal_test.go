@@ -0,0 +1,288 @@
+package primitive
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// goldenWrites maps the golden files written with -update to the test that
+// wrote them, so that tests running in parallel cannot share a file.
+var goldenWrites sync.Map
+
+// claimGolden fails the test if another test has written path.
+func claimGolden(t *testing.T, path string) {
+	t.Helper()
+	if name, _ := goldenWrites.LoadOrStore(path, t.Name()); name != t.Name() {
+		t.Fatalf("%s is also written by %s", path, name)
+	}
+}
+
+const goldenSize = 64
+
+// goldenShapes are named after their type, with a suffix for variants of
+// a type.
+var goldenShapes = []struct {
+	Suffix string
+	Params []float64
+	Type   ShapeType
+}{
+	{"", []float64{8, 6, 58, 20, 20, 56}, ShapeTypeTriangle},
+	{"", []float64{10, 14, 50, 40}, ShapeTypeRectangle},
+	{"", []float64{32, 30, 24, 12}, ShapeTypeEllipse},
+	{"", []float64{30, 34, 20, 20}, ShapeTypeCircle},
+	{"", []float64{32, 32, 40, 16, 30}, ShapeTypeRotatedRectangle},
+	{"", []float64{6, 50, 30, 2, 58, 44, 4}, ShapeTypeQuadratic},
+	{"", []float64{32, 32, 26, 10, 60}, ShapeTypeRotatedEllipse},
+	{"", []float64{6, 8, 56, 12, 40, 56, 24, 30}, ShapeTypePolygon},
+	{"", []float64{4, 40, 20, 0, 44, 62, 60, 20, 5}, ShapeTypeCubic},
+	{"", []float64{32, 6, 56, 30, 36, 58, 10, 36}, ShapeTypeBlob},
+	{"", []float64{6, 10, 54, 50, 3, float64(LineCapButt)}, ShapeTypeLine},
+	{"", []float64{6, 56, 20, 8, 36, 52, 58, 6, 4, float64(LineCapSquare), float64(LineJoinBevel)}, ShapeTypePolyline},
+	{"", []float64{32, 30, 48, 15, 'R'}, ShapeTypeGlyph},
+	{"", []float64{30, 32, 36, 30}, ShapeTypeStamp},
+	{"", []float64{32, 32, 26, 10, 6}, ShapeTypeRegularPolygon},
+	{"", []float64{32, 34, 28, -8, 5, 0.45}, ShapeTypeStar},
+	{".outline", []float64{8, 6, 58, 20, 20, 56, 3}, ShapeTypeTriangle},
+	{".outline", []float64{32, 30, 24, 12, 2.5}, ShapeTypeEllipse},
+	{".outline", []float64{30, 34, 20, 20, 4}, ShapeTypeCircle},
+	{".outline", []float64{32, 32, 26, 10, 60, 3}, ShapeTypeRotatedEllipse},
+	{".outline", []float64{6, 8, 56, 12, 40, 56, 24, 30, 2}, ShapeTypePolygon},
+	{".order3", []float64{8, 10, 56, 20, 24, 54}, ShapeTypePolygon},
+}
+
+var (
+	goldenBackground = Color{R: 255, G: 255, B: 255, A: 255}
+	goldenColor      = Color{R: 0, G: 0, B: 0, A: 255}
+)
+
+func goldenShapeFile(i int) *ShapeFile {
+	s := goldenShapes[i]
+	return &ShapeFile{
+		Background: goldenBackground,
+		Shapes: []ShapeRecord{
+			{Type: s.Type.String(), Params: s.Params, Color: goldenColor, Gradient: nil, Score: 0},
+		},
+		Blend:  BlendNormal,
+		Width:  goldenSize,
+		Height: goldenSize,
+	}
+}
+
+func goldenModel(t *testing.T, i int) *Model {
+	t.Helper()
+	opts := DefaultShapeOptions()
+	font, err := ParseFont(goregular.TTF, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Font = font
+	opts.Sprite = goldenSprite()
+	model, err := goldenShapeFile(i).Model(goldenSize, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model
+}
+
+// goldenSprite is a 12x8 ring with soft edges.
+func goldenSprite() *Sprite {
+	im := image.NewNRGBA(image.Rect(0, 0, 12, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 12; x++ {
+			dx, dy := (float64(x)-5.5)/6, (float64(y)-3.5)/4
+			d := math.Abs(math.Hypot(dx, dy) - 0.6)
+			a := clamp(1-d*4, 0, 1)
+			im.SetNRGBA(x, y, color.NRGBA{R: 0, G: 0, B: 0, A: uint8(a * 255)})
+		}
+	}
+	return NewSprite(im)
+}
+
+// checkGolden compares got with testdata/name, rewriting the file when the
+// tests are run with -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		claimGolden(t, path)
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: output does not match golden file", name)
+	}
+}
+
+func checkGoldenImage(t *testing.T, name string, got *image.RGBA) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		claimGolden(t, path)
+		if err := SavePNG(path, got); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	im, err := LoadImage(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	want := imageToRGBA(im)
+	if !want.Bounds().Eq(got.Bounds()) {
+		t.Fatalf("%s: size %v, want %v", name, got.Bounds().Size(), want.Bounds().Size())
+	}
+	diff := 0
+	for i := range got.Pix {
+		if got.Pix[i] != want.Pix[i] {
+			diff++
+		}
+	}
+	if diff > 0 {
+		t.Errorf("%s: %d bytes differ from golden image", name, diff)
+	}
+}
+
+func TestRasterizeGolden(t *testing.T) {
+	t.Parallel()
+	for i, s := range goldenShapes {
+		t.Run(s.Type.String()+s.Suffix, func(t *testing.T) {
+			t.Parallel()
+			model := goldenModel(t, i)
+			checkGoldenImage(t, s.Type.String()+s.Suffix+".png", model.Current)
+		})
+	}
+}
+
+func TestDrawGolden(t *testing.T) {
+	t.Parallel()
+	for i, s := range goldenShapes {
+		t.Run(s.Type.String()+s.Suffix, func(t *testing.T) {
+			t.Parallel()
+			model := goldenModel(t, i)
+			checkGoldenImage(t, s.Type.String()+s.Suffix+".draw.png", imageToRGBA(model.Context.Image()))
+		})
+	}
+}
+
+// TestRasterizeMatchesDraw checks that the scanlines used to score a shape
+// cover the same pixels as the anti-aliased path gg draws for the output.
+// Pixels on the edge of either shape may differ by one pixel, and a few may
+// be further off: the triangle rasterizer truncates its split point to whole
+// pixels.
+func TestRasterizeMatchesDraw(t *testing.T) {
+	t.Parallel()
+	mask := func(im *image.RGBA) [][]bool {
+		m := make([][]bool, goldenSize)
+		for y := range m {
+			m[y] = make([]bool, goldenSize)
+			for x := range m[y] {
+				m[y][x] = im.RGBAAt(x, y).R < 128
+			}
+		}
+		return m
+	}
+	near := func(m [][]bool, x, y int, v bool) bool {
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				nx, ny := x+dx, y+dy
+				if nx >= 0 && ny >= 0 && nx < goldenSize && ny < goldenSize && m[ny][nx] == v {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for i, s := range goldenShapes {
+		t.Run(s.Type.String()+s.Suffix, func(t *testing.T) {
+			t.Parallel()
+			model := goldenModel(t, i)
+			a := mask(model.Current)
+			b := mask(imageToRGBA(model.Context.Image()))
+			count, diff := 0, 0
+			for y := 0; y < goldenSize; y++ {
+				for x := 0; x < goldenSize; x++ {
+					if a[y][x] {
+						count++
+					}
+					if a[y][x] != b[y][x] && !near(b, x, y, a[y][x]) {
+						diff++
+					}
+				}
+			}
+			if count == 0 {
+				t.Fatal("shape covers no pixels")
+			}
+			if diff*100 > count {
+				t.Errorf("%d of %d pixels differ by more than one pixel from the drawn shape", diff, count)
+			}
+		})
+	}
+}
+
+func TestSVGGolden(t *testing.T) {
+	t.Parallel()
+	for i, s := range goldenShapes {
+		t.Run(s.Type.String()+s.Suffix, func(t *testing.T) {
+			t.Parallel()
+			model := goldenModel(t, i)
+			checkGolden(t, s.Type.String()+s.Suffix+".svg", []byte(model.SVG()))
+		})
+	}
+}
+
+func TestSVGRoundTrip(t *testing.T) {
+	t.Parallel()
+	for i, s := range goldenShapes {
+		t.Run(s.Type.String()+s.Suffix, func(t *testing.T) {
+			t.Parallel()
+			want := goldenShapeFile(i)
+			file, err := ReadSVG(strings.NewReader(goldenModel(t, i).SVG()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(file, want) {
+				t.Errorf("got %+v, want %+v", file, want)
+			}
+		})
+	}
+}
+
+func TestShapeFileRoundTrip(t *testing.T) {
+	t.Parallel()
+	for i, s := range goldenShapes {
+		t.Run(s.Type.String()+s.Suffix, func(t *testing.T) {
+			t.Parallel()
+			want := goldenShapeFile(i)
+			b, err := goldenModel(t, i).JSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			file, err := ReadShapeFile(bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(file, want) {
+				t.Errorf("got %+v, want %+v", file, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package primitive
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/fogleman/gg"
+)
+
+// Gradient paints a shape with colors that change across it instead of a
+// single color. It starts at the shape's color and ends at Color. A linear
+// gradient runs from (X1, Y1) to (X2, Y2); a radial one starts at the
+// center (X1, Y1) and ends R pixels away. Past either end the color of that
+// end is used. Coordinates are in pixels of the scoring image, like those
+// of the shapes.
+type Gradient struct {
+	Radial bool    `json:"radial,omitempty"`
+	X1     float64 `json:"x1"`
+	Y1     float64 `json:"y1"`
+	X2     float64 `json:"x2,omitempty"`
+	Y2     float64 `json:"y2,omitempty"`
+	R      float64 `json:"r,omitempty"`
+	Color  Color   `json:"color"`
+}
+
+// offset returns how far along the gradient the point x, y is, from 0 at
+// the start to 1 at the end.
+func (g *Gradient) offset(x, y float64) float64 {
+	dx, dy := x-g.X1, y-g.Y1
+	if g.Radial {
+		if g.R <= 0 {
+			return 0
+		}
+		return math.Min(math.Sqrt(dx*dx+dy*dy)/g.R, 1)
+	}
+	ux, uy := g.X2-g.X1, g.Y2-g.Y1
+	d := ux*ux + uy*uy
+	if d == 0 {
+		return 0
+	}
+	return clamp((dx*ux+dy*uy)/d, 0, 1)
+}
+
+// degenerate reports whether the gradient has no length, so that it is
+// its start color everywhere.
+func (g *Gradient) degenerate() bool {
+	if g.Radial {
+		return g.R <= 0
+	}
+	return g.X1 == g.X2 && g.Y1 == g.Y2
+}
+
+func (g *Gradient) scaled(s float64) *Gradient {
+	return &Gradient{
+		Radial: g.Radial,
+		X1:     g.X1 * s,
+		Y1:     g.Y1 * s,
+		X2:     g.X2 * s,
+		Y2:     g.Y2 * s,
+		R:      g.R * s,
+		Color:  g.Color,
+	}
+}
+
+// computePaint returns the color, and for gradient fills the gradient,
+// that best fit the target where the shape's scanlines are drawn. With a
+// palette, the colors are then snapped to the nearest palette colors.
+// Gradients are only solved for the normal blend mode; with other modes
+// shapes get flat colors. An alpha of zero is solved too; see solveAlpha.
+func computePaint(target, current *image.RGBA, lines []Scanline, alpha int, opts *ShapeOptions) (Color, *Gradient) {
+	if alpha == 0 {
+		alpha = solveAlpha(target, current, lines, opts)
+	}
+	var c Color
+	var g *Gradient
+	switch {
+	case opts.Blend != BlendNormal:
+		c = computeBlendColor(target, current, lines, alpha, opts.Blend)
+	case opts.Fill == FillLinear:
+		c, g = computeLinearGradient(target, current, lines, alpha)
+	case opts.Fill == FillRadial:
+		c, g = computeRadialGradient(target, current, lines, alpha)
+	default:
+		c = computeColor(target, current, lines, alpha)
+	}
+	if opts.Palette != nil {
+		c = opts.Palette.Nearest(c)
+		if g != nil {
+			g.Color = opts.Palette.Nearest(g.Color)
+		}
+	}
+	return c, g
+}
+
+// drawPaint draws the scanlines with a color or gradient from computePaint.
+func drawPaint(im *image.RGBA, c Color, g *Gradient, mode BlendMode, lines []Scanline) {
+	switch {
+	case mode != BlendNormal:
+		drawBlendLines(im, c, g, mode, lines)
+	case g == nil:
+		drawLines(im, c, lines)
+	default:
+		drawGradientLines(im, c, g, lines)
+	}
+}
+
+// computeLinearGradient solves for the linear gradient that best fits the
+// target. Like computeColor, each pixel has an ideal color: the one that,
+// drawn at alpha over the current image, gives the target. A plane is
+// fitted to the ideal colors of each channel by least squares, and the
+// gradient runs across the shape in the direction the planes change most.
+// The end colors are then the least squares fit along that direction.
+func computeLinearGradient(target, current *image.RGBA, lines []Scanline, alpha int) (Color, *Gradient) {
+	k := 255 / float64(alpha)
+	var n, sx, sy, sxx, sxy, syy float64
+	var sv, sxv, syv [3]float64
+	for _, line := range lines {
+		y := float64(line.Y)
+		i := target.PixOffset(line.X1, line.Y)
+		for x := line.X1; x <= line.X2; x++ {
+			fx := float64(x)
+			for j := range 3 {
+				c := float64(current.Pix[i+j])
+				v := c + (float64(target.Pix[i+j])-c)*k
+				sv[j] += v
+				sxv[j] += fx * v
+				syv[j] += y * v
+			}
+			n++
+			sx += fx
+			sy += y
+			sxx += fx * fx
+			sxy += fx * y
+			syy += y * y
+			i += 4
+		}
+	}
+	if n == 0 {
+		return computeColor(target, current, lines, alpha), nil
+	}
+	mx, my := sx/n, sy/n
+	cxx, cxy, cyy := sxx/n-mx*mx, sxy/n-mx*my, syy/n-my*my
+	// a little ridge keeps the solve stable for shapes one pixel thick
+	e := 1e-9*(cxx+cyy) + 1e-12
+	det := (cxx+e)*(cyy+e) - cxy*cxy
+	var mean, cxv, cyv [3]float64
+	var gxx, gxy, gyy float64
+	for j := range 3 {
+		mean[j] = sv[j] / n
+		cxv[j] = sxv[j]/n - mx*mean[j]
+		cyv[j] = syv[j]/n - my*mean[j]
+		gx := ((cyy+e)*cxv[j] - cxy*cyv[j]) / det
+		gy := ((cxx+e)*cyv[j] - cxy*cxv[j]) / det
+		gxx += gx * gx
+		gxy += gx * gy
+		gyy += gy * gy
+	}
+	theta := math.Atan2(2*gxy, gxx-gyy) / 2
+	ux, uy := math.Cos(theta), math.Sin(theta)
+	tmin, tmax := math.Inf(1), math.Inf(-1)
+	for _, line := range lines {
+		for _, x := range [2]int{line.X1, line.X2} {
+			t := (float64(x)-mx)*ux + (float64(line.Y)-my)*uy
+			tmin = math.Min(tmin, t)
+			tmax = math.Max(tmax, t)
+		}
+	}
+	var c1, c2 [3]int
+	ctt := ux*ux*cxx + 2*ux*uy*cxy + uy*uy*cyy
+	for j := range 3 {
+		b := 0.0
+		if ctt > 0 {
+			b = (ux*cxv[j] + uy*cyv[j]) / ctt
+		}
+		c1[j] = clampInt(int(math.Round(mean[j]+b*tmin)), 0, 255)
+		c2[j] = clampInt(int(math.Round(mean[j]+b*tmax)), 0, 255)
+	}
+	return Color{c1[0], c1[1], c1[2], alpha}, &Gradient{
+		Radial: false,
+		X1:     mx + tmin*ux,
+		Y1:     my + tmin*uy,
+		X2:     mx + tmax*ux,
+		Y2:     my + tmax*uy,
+		R:      0,
+		Color:  Color{c2[0], c2[1], c2[2], alpha},
+	}
+}
+
+// computeRadialGradient solves for the radial gradient centered on the
+// shape's centroid that best fits the target, with the end colors fitted
+// by least squares against the distance from the center.
+func computeRadialGradient(target, current *image.RGBA, lines []Scanline, alpha int) (Color, *Gradient) {
+	var n, sx, sy float64
+	for _, line := range lines {
+		m := float64(line.X2 - line.X1 + 1)
+		n += m
+		sx += m * float64(line.X1+line.X2) / 2
+		sy += m * float64(line.Y)
+	}
+	if n == 0 {
+		return computeColor(target, current, lines, alpha), nil
+	}
+	mx, my := sx/n, sy/n
+	// distance along a scanline is largest at one of its ends
+	r := 0.0
+	for _, line := range lines {
+		dy := float64(line.Y) - my
+		for _, x := range [2]int{line.X1, line.X2} {
+			dx := float64(x) - mx
+			r = math.Max(r, math.Sqrt(dx*dx+dy*dy))
+		}
+	}
+	k := 255 / float64(alpha)
+	var sd, sdd float64
+	var sv, sdv [3]float64
+	for _, line := range lines {
+		dy := float64(line.Y) - my
+		i := target.PixOffset(line.X1, line.Y)
+		for x := line.X1; x <= line.X2; x++ {
+			dx := float64(x) - mx
+			d := math.Sqrt(dx*dx + dy*dy)
+			for j := range 3 {
+				c := float64(current.Pix[i+j])
+				v := c + (float64(target.Pix[i+j])-c)*k
+				sv[j] += v
+				sdv[j] += d * v
+			}
+			sd += d
+			sdd += d * d
+			i += 4
+		}
+	}
+	md := sd / n
+	cdd := sdd/n - md*md
+	var c1, c2 [3]int
+	for j := range 3 {
+		mean := sv[j] / n
+		b := 0.0
+		if cdd > 0 {
+			b = (sdv[j]/n - md*mean) / cdd
+		}
+		a := mean - b*md
+		c1[j] = clampInt(int(math.Round(a)), 0, 255)
+		c2[j] = clampInt(int(math.Round(a+b*r)), 0, 255)
+	}
+	return Color{c1[0], c1[1], c1[2], alpha}, &Gradient{
+		Radial: true,
+		X1:     mx,
+		Y1:     my,
+		X2:     0,
+		Y2:     0,
+		R:      r,
+		Color:  Color{c2[0], c2[1], c2[2], alpha},
+	}
+}
+
+// drawGradientLines is drawLines for a gradient that starts at c. Where
+// the gradient is c throughout, it draws the same pixels as drawLines.
+func drawGradientLines(im *image.RGBA, c Color, g *Gradient, lines []Scanline) {
+	const m = 0xffff
+	sa := uint32(c.A) * 0x101
+	r1, g1, b1 := float64(c.R), float64(c.G), float64(c.B)
+	dr, dg, db := float64(g.Color.R)-r1, float64(g.Color.G)-g1, float64(g.Color.B)-b1
+	for _, line := range lines {
+		ma := line.Alpha
+		a := (m - sa*ma/m) * 0x101
+		y := float64(line.Y)
+		i := im.PixOffset(line.X1, line.Y)
+		for x := line.X1; x <= line.X2; x++ {
+			t := g.offset(float64(x), y)
+			sr := uint32(math.Round(r1+dr*t)) * 0x101 * sa / m
+			sg := uint32(math.Round(g1+dg*t)) * 0x101 * sa / m
+			sb := uint32(math.Round(b1+db*t)) * 0x101 * sa / m
+			im.Pix[i+0] = uint8((uint32(im.Pix[i+0])*a + sr*ma) / m >> 8)
+			im.Pix[i+1] = uint8((uint32(im.Pix[i+1])*a + sg*ma) / m >> 8)
+			im.Pix[i+2] = uint8((uint32(im.Pix[i+2])*a + sb*ma) / m >> 8)
+			im.Pix[i+3] = uint8((uint32(im.Pix[i+3])*a + sa*ma) / m >> 8)
+			i += 4
+		}
+	}
+}
+
+// setPaint makes c, or the gradient g starting at c, the fill and stroke
+// of dc. gg places gradients in device pixels, so g is mapped through the
+// current transform, which must not rotate or skew.
+func setPaint(dc *gg.Context, c Color, g *Gradient) {
+	if g == nil || g.degenerate() {
+		dc.SetRGBA255(c.R, c.G, c.B, c.A)
+		return
+	}
+	var p gg.Gradient
+	x1, y1 := dc.TransformPoint(g.X1, g.Y1)
+	if g.Radial {
+		x2, y2 := dc.TransformPoint(g.X1+g.R, g.Y1)
+		p = gg.NewRadialGradient(x1, y1, 0, x1, y1, math.Hypot(x2-x1, y2-y1))
+	} else {
+		// gg samples linear gradients at pixel corners, not centers
+		x2, y2 := dc.TransformPoint(g.X2, g.Y2)
+		p = gg.NewLinearGradient(x1-0.5, y1-0.5, x2-0.5, y2-0.5)
+	}
+	p.AddColorStop(0, c.NRGBA())
+	p.AddColorStop(1, g.Color.NRGBA())
+	dc.SetFillStyle(p)
+	dc.SetStrokeStyle(p)
+}
+
+// svgTransformer is implemented by shapes whose SVG is drawn in a group
+// translated to x, y, rotated by angle degrees and scaled by sx, sy.
+type svgTransformer interface {
+	svgTransform() (x, y, angle, sx, sy float64)
+}
+
+// svg writes the gradient as a definition with the given id, for a shape
+// whose color is c. The gradient is in the image's coordinates, so for a
+// shape drawn in a transformed group it gets the inverse transform.
+func (g *Gradient) svg(id string, c Color, shape Shape) string {
+	var transform string
+	if t, ok := shape.(svgTransformer); ok {
+		x, y, angle, sx, sy := t.svgTransform()
+		transform = fmt.Sprintf(
+			` gradientTransform="scale(%f %f) rotate(%f) translate(%f %f)"`,
+			1/sx, 1/sy, -angle, -x, -y)
+	}
+	stop := func(offset int, c Color) string {
+		return fmt.Sprintf(
+			`<stop offset="%d" stop-color="#%02x%02x%02x" stop-opacity="%f" />`,
+			offset, c.R, c.G, c.B, float64(c.A)/255)
+	}
+	if g.Radial {
+		return fmt.Sprintf(
+			`<radialGradient id="%s" gradientUnits="userSpaceOnUse" cx="%f" cy="%f" r="%f"%s>%s%s</radialGradient>`,
+			id, g.X1, g.Y1, g.R, transform, stop(0, c), stop(1, g.Color))
+	}
+	return fmt.Sprintf(
+		`<linearGradient id="%s" gradientUnits="userSpaceOnUse" x1="%f" y1="%f" x2="%f" y2="%f"%s>%s%s</linearGradient>`,
+		id, g.X1, g.Y1, g.X2, g.Y2, transform, stop(0, c), stop(1, g.Color))
+}
@@ -0,0 +1,222 @@
+package primitive
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestComputeGradient(t *testing.T) {
+	t.Parallel()
+	const size = 64
+	bounds := image.Rect(0, 0, size, size)
+	current := uniformRGBA(bounds, color.NRGBA{128, 128, 128, 255})
+	tests := []struct {
+		at   func(x, y float64) color.NRGBA
+		fill Fill
+	}{
+		{fill: FillLinear, at: func(x, y float64) color.NRGBA {
+			d := x + y
+			return color.NRGBA{uint8(40 + d*1.5), uint8(200 - d), 100, 255}
+		}},
+		{fill: FillRadial, at: func(x, y float64) color.NRGBA {
+			d := math.Hypot(x-31.5, y-31.5)
+			return color.NRGBA{uint8(30 + d*2), uint8(220 - d*3), 100, 255}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fill.String(), func(t *testing.T) {
+			t.Parallel()
+			target := image.NewRGBA(bounds)
+			for y := 0; y < size; y++ {
+				for x := 0; x < size; x++ {
+					target.SetRGBA(x, y, color.RGBA(tt.at(float64(x), float64(y))))
+				}
+			}
+			lines := fullLines(size, size)
+			opts := DefaultShapeOptions()
+			opts.Fill = tt.fill
+			c, g := computePaint(target, current, lines, 255, &opts)
+			if g == nil || g.Radial != (tt.fill == FillRadial) {
+				t.Fatalf("got gradient %+v for %s fill", g, tt.fill)
+			}
+			im := copyRGBA(current)
+			drawGradientLines(im, c, g, lines)
+			for i := range im.Pix {
+				if d := int(im.Pix[i]) - int(target.Pix[i]); d < -2 || d > 2 {
+					t.Fatalf("pixel %d: got %d, want %d (color %v, gradient %+v)", i/4, im.Pix[i], target.Pix[i], c, g)
+				}
+			}
+		})
+	}
+}
+
+func TestComputeGradientEmpty(t *testing.T) {
+	t.Parallel()
+	im := uniformRGBA(image.Rect(0, 0, 8, 8), color.NRGBA{10, 20, 30, 255})
+	for _, fill := range []Fill{FillLinear, FillRadial} {
+		opts := DefaultShapeOptions()
+		opts.Fill = fill
+		if c, g := computePaint(im, im, nil, 128, &opts); g != nil || c != (Color{R: 0, G: 0, B: 0, A: 0}) {
+			t.Errorf("%s: got %v and %+v for no scanlines", fill, c, g)
+		}
+	}
+}
+
+// TestDrawGradientLinesFlat checks that a gradient between two equal colors
+// composites exactly like a flat color, including partly covered scanlines.
+func TestDrawGradientLinesFlat(t *testing.T) {
+	t.Parallel()
+	bounds := image.Rect(0, 0, 8, 8)
+	lines := fullLines(8, 8)
+	for i := range lines {
+		lines[i].Alpha = uint32(i+1) * 0xffff / 8
+	}
+	c := Color{R: 200, G: 40, B: 90, A: 100}
+	want := uniformRGBA(bounds, color.NRGBA{20, 120, 220, 255})
+	got := copyRGBA(want)
+	drawLines(want, c, lines)
+	g := &Gradient{Radial: false, X1: 0, Y1: 0, X2: 7, Y2: 7, R: 0, Color: c}
+	drawGradientLines(got, c, g, lines)
+	if !bytes.Equal(got.Pix, want.Pix) {
+		t.Error("gradient with equal stops differs from a flat color")
+	}
+}
+
+func gradientShapeFile() *ShapeFile {
+	red, blue := Color{R: 220, G: 30, B: 30, A: 255}, Color{R: 30, G: 30, B: 220, A: 255}
+	return &ShapeFile{
+		Background: goldenBackground,
+		Shapes: []ShapeRecord{
+			{
+				Type:     ShapeTypeRotatedRectangle.String(),
+				Params:   []float64{32, 20, 48, 20, 20},
+				Color:    red,
+				Gradient: &Gradient{Radial: false, X1: 10, Y1: 20, X2: 54, Y2: 20, R: 0, Color: blue},
+				Score:    0,
+			},
+			{
+				Type:     ShapeTypeCircle.String(),
+				Params:   []float64{32, 44, 16, 16},
+				Color:    blue,
+				Gradient: &Gradient{Radial: true, X1: 28, Y1: 40, X2: 0, Y2: 0, R: 20, Color: red},
+				Score:    0,
+			},
+			{
+				Type:     ShapeTypeLine.String(),
+				Params:   []float64{4, 60, 60, 4, 3, float64(LineCapButt)},
+				Color:    goldenColor,
+				Gradient: &Gradient{Radial: false, X1: 4, Y1: 60, X2: 60, Y2: 4, R: 0, Color: red},
+				Score:    0,
+			},
+		},
+		Blend:  BlendNormal,
+		Width:  goldenSize,
+		Height: goldenSize,
+	}
+}
+
+func TestGradientGolden(t *testing.T) {
+	t.Parallel()
+	want := gradientShapeFile()
+	model, err := want.Model(goldenSize, DefaultShapeOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := model.SVG()
+	checkGolden(t, "gradient.svg", []byte(svg))
+	file, err := ReadSVG(strings.NewReader(svg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(file, want) {
+		t.Errorf("svg: got %+v, want %+v", file, want)
+	}
+	b, err := model.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err = ReadShapeFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(file, want) {
+		t.Errorf("json: got %+v, want %+v", file, want)
+	}
+}
+
+// TestGradientMatchesDraw checks that gg draws gradients where the scanline
+// renderer puts them. The shapes' edges are left out: they differ between
+// the two even with flat colors, which is what finds them.
+func TestGradientMatchesDraw(t *testing.T) {
+	t.Parallel()
+	file := gradientShapeFile()
+	flat := *file
+	flat.Shapes = make([]ShapeRecord, len(file.Shapes))
+	for i, record := range file.Shapes {
+		record.Gradient = nil
+		flat.Shapes[i] = record
+	}
+	render := func(f *ShapeFile) (*image.RGBA, *image.RGBA) {
+		model, err := f.Model(goldenSize, DefaultShapeOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return model.Current, imageToRGBA(model.Context.Image())
+	}
+	differ := func(a, b *image.RGBA, i int) bool {
+		for j := i; j < i+4; j++ {
+			if d := int(a.Pix[j]) - int(b.Pix[j]); d < -8 || d > 8 {
+				return true
+			}
+		}
+		return false
+	}
+	a, b := render(file)
+	fa, fb := render(&flat)
+	count, diff := 0, 0
+	for i := 0; i < len(a.Pix); i += 4 {
+		if differ(fa, fb, i) {
+			continue
+		}
+		count++
+		if differ(a, b, i) {
+			diff++
+		}
+	}
+	if diff*100 > count {
+		t.Errorf("%d of %d pixels inside the shapes differ from the drawn gradients", diff, count)
+	}
+}
+
+// TestGradientOutlineSVG checks that an outline strokes with its gradient
+// and leaves the shape unfilled.
+func TestGradientOutlineSVG(t *testing.T) {
+	t.Parallel()
+	file := &ShapeFile{
+		Background: goldenBackground,
+		Shapes: []ShapeRecord{{
+			Type:     ShapeTypeTriangle.String(),
+			Gradient: &Gradient{Radial: false, X1: 8, Y1: 6, X2: 58, Y2: 20, R: 0, Color: goldenColor},
+			Params:   []float64{8, 6, 58, 20, 20, 56, 3},
+			Color:    Color{R: 220, G: 30, B: 30, A: 255},
+			Score:    0,
+		}},
+		Blend:  BlendNormal,
+		Width:  goldenSize,
+		Height: goldenSize,
+	}
+	model, err := file.Model(goldenSize, DefaultShapeOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := model.SVG()
+	want := `<polygon stroke="url(#gradient0)" fill="none" stroke-width="3.000000" stroke-linejoin="round" points=`
+	if !strings.Contains(svg, want) {
+		t.Errorf("svg: got %s, want it to contain %s", svg, want)
+	}
+}
@@ -0,0 +1,27 @@
+package primitive
+
+// Limiter caps the number of hill climbs running at once. Sharing one
+// limiter between models lets several images be processed concurrently
+// without oversubscribing the CPU.
+type Limiter struct {
+	tokens chan struct{}
+}
+
+func NewLimiter(n int) *Limiter {
+	return &Limiter{tokens: make(chan struct{}, max(n, 1))}
+}
+
+// Acquire blocks until a slot is free. A nil limiter never blocks.
+func (l *Limiter) Acquire() {
+	if l == nil {
+		return
+	}
+	l.tokens <- struct{}{}
+}
+
+func (l *Limiter) Release() {
+	if l == nil {
+		return
+	}
+	<-l.tokens
+}
@@ -0,0 +1,192 @@
+package primitive
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/raster"
+)
+
+type Line struct {
+	Worker *Worker
+	X1, Y1 float64
+	X2, Y2 float64
+	Width  float64
+	Cap    LineCap
+}
+
+func NewRandomLine(worker *Worker) *Line {
+	rnd := worker.Rnd
+	s := worker.spawnScale()
+	x1 := rnd.Float64() * float64(worker.W)
+	y1 := rnd.Float64() * float64(worker.H)
+	x2 := x1 + (rnd.Float64()*40-20)*s
+	y2 := y1 + (rnd.Float64()*40-20)*s
+	l := &Line{worker, x1, y1, x2, y2, 1, worker.Options.LineCap}
+	l.Mutate()
+	return l
+}
+
+func (l *Line) Draw(dc *gg.Context, scale float64) {
+	dc.Push()
+	dc.SetLineCap(l.Cap.gg())
+	dc.SetLineWidth(l.Width * scale)
+	dc.DrawLine(l.X1, l.Y1, l.X2, l.Y2)
+	dc.Stroke()
+	dc.Pop()
+}
+
+func (l *Line) SVG(attrs string) string {
+	attrs = strings.Replace(attrs, "fill", "stroke", -1)
+	return fmt.Sprintf(
+		"<line %s fill=\"none\" x1=\"%f\" y1=\"%f\" x2=\"%f\" y2=\"%f\" stroke-width=\"%f\" stroke-linecap=\"%s\" />",
+		attrs, l.X1, l.Y1, l.X2, l.Y2, l.Width, l.Cap)
+}
+
+func (l *Line) Copy() Shape {
+	a := *l
+	return &a
+}
+
+func (l *Line) Mutate() {
+	w := l.Worker.W
+	h := l.Worker.H
+	rnd := l.Worker.Rnd
+	limits := l.Worker.constraints(ShapeTypeLine)
+	m := limits.Margin
+	saved := *l
+	for range mutateTries {
+		switch rnd.Intn(3) {
+		case 0:
+			l.X1 = clamp(l.X1+rnd.NormFloat64()*limits.Step, -m, float64(w-1)+m)
+			l.Y1 = clamp(l.Y1+rnd.NormFloat64()*limits.Step, -m, float64(h-1)+m)
+		case 1:
+			l.X2 = clamp(l.X2+rnd.NormFloat64()*limits.Step, -m, float64(w-1)+m)
+			l.Y2 = clamp(l.Y2+rnd.NormFloat64()*limits.Step, -m, float64(h-1)+m)
+		case 2:
+			k := l.Worker.canvasScale()
+			l.Width = clamp(l.Width+rnd.NormFloat64()/2*k, 0.5, 16*k)
+		}
+		if l.Valid() {
+			return
+		}
+	}
+	*l = saved
+}
+
+// Valid checks the line against its size and aspect constraints.
+func (l *Line) Valid() bool {
+	return l.Worker.constraints(ShapeTypeLine).fitsPoints([]float64{l.X1, l.X2}, []float64{l.Y1, l.Y2})
+}
+
+func (l *Line) Rasterize() []Scanline {
+	var path raster.Path
+	path.Start(fixp(l.X1, l.Y1))
+	path.Add1(fixp(l.X2, l.Y2))
+	return strokePath(l.Worker, path, fix(l.Width), l.Cap.capper(), raster.RoundJoiner)
+}
+
+type Polyline struct {
+	Worker *Worker
+	X      []float64
+	Y      []float64
+	Order  int
+	Width  float64
+	Cap    LineCap
+	Join   LineJoin
+}
+
+func NewRandomPolyline(worker *Worker, order int) *Polyline {
+	rnd := worker.Rnd
+	s := worker.spawnScale()
+	x := make([]float64, order)
+	y := make([]float64, order)
+	x[0] = rnd.Float64() * float64(worker.W)
+	y[0] = rnd.Float64() * float64(worker.H)
+	for i := 1; i < order; i++ {
+		x[i] = x[i-1] + (rnd.Float64()*40-20)*s
+		y[i] = y[i-1] + (rnd.Float64()*40-20)*s
+	}
+	p := &Polyline{
+		Worker: worker,
+		X:      x,
+		Y:      y,
+		Order:  order,
+		Width:  1,
+		Cap:    worker.Options.LineCap,
+		Join:   worker.Options.LineJoin,
+	}
+	p.Mutate()
+	return p
+}
+
+func (p *Polyline) Draw(dc *gg.Context, scale float64) {
+	dc.Push()
+	dc.SetLineCap(p.Cap.gg())
+	dc.SetLineJoin(p.Join.gg())
+	dc.SetLineWidth(p.Width * scale)
+	dc.NewSubPath()
+	for i := 0; i < p.Order; i++ {
+		dc.LineTo(p.X[i], p.Y[i])
+	}
+	dc.Stroke()
+	dc.Pop()
+}
+
+func (p *Polyline) SVG(attrs string) string {
+	attrs = strings.Replace(attrs, "fill", "stroke", -1)
+	points := make([]string, p.Order)
+	for i := 0; i < p.Order; i++ {
+		points[i] = fmt.Sprintf("%f,%f", p.X[i], p.Y[i])
+	}
+	return fmt.Sprintf(
+		"<polyline %s fill=\"none\" points=\"%s\" stroke-width=\"%f\" stroke-linecap=\"%s\" stroke-linejoin=\"%s\" />",
+		attrs, strings.Join(points, " "), p.Width, p.Cap, p.Join)
+}
+
+func (p *Polyline) Copy() Shape {
+	a := *p
+	a.X = make([]float64, p.Order)
+	a.Y = make([]float64, p.Order)
+	copy(a.X, p.X)
+	copy(a.Y, p.Y)
+	return &a
+}
+
+func (p *Polyline) Mutate() {
+	w := p.Worker.W
+	h := p.Worker.H
+	rnd := p.Worker.Rnd
+	limits := p.Worker.constraints(ShapeTypePolyline)
+	m := limits.Margin
+	saved, _ := p.Copy().(*Polyline)
+	for range mutateTries {
+		if rnd.Intn(p.Order+1) == 0 {
+			k := p.Worker.canvasScale()
+			p.Width = clamp(p.Width+rnd.NormFloat64()/2*k, 0.5, 16*k)
+		} else {
+			i := rnd.Intn(p.Order)
+			p.X[i] = clamp(p.X[i]+rnd.NormFloat64()*limits.Step, -m, float64(w-1)+m)
+			p.Y[i] = clamp(p.Y[i]+rnd.NormFloat64()*limits.Step, -m, float64(h-1)+m)
+		}
+		if p.Valid() {
+			return
+		}
+	}
+	*p = *saved
+}
+
+// Valid checks the polyline against its size and aspect constraints.
+func (p *Polyline) Valid() bool {
+	return p.Worker.constraints(ShapeTypePolyline).fitsPoints(p.X, p.Y)
+}
+
+func (p *Polyline) Rasterize() []Scanline {
+	var path raster.Path
+	path.Start(fixp(p.X[0], p.Y[0]))
+	for i := 1; i < p.Order; i++ {
+		path.Add1(fixp(p.X[i], p.Y[i]))
+	}
+	return strokePath(p.Worker, path, fix(p.Width), p.Cap.capper(), p.Join.joiner())
+}
@@ -5,7 +5,12 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"log/slog"
+	"math"
+	"math/rand"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/fogleman/gg"
 )
@@ -15,34 +20,34 @@ type Model struct {
 	Current    *image.RGBA
 	Context    *gg.Context
 	Background *Color
+	Limiter    *Limiter
+	OnAdd      func(shape Shape, color Color, gradient *Gradient, score float64)
+	pool       *pool      // started by the first step; see Close
+	rnd        *rand.Rand // seeds the hill climbs of each step
 	Shapes     []Shape
 	Colors     []Color
+	Gradients  []*Gradient // nil where a shape has a flat color
 	Scores     []float64
 	Workers    []*Worker
+	rows       []uint64 // Total by row; see RowError
+	tileCells  []tile
 	Sw         int
 	Sh         int
 	Scale      float64
 	Score      float64
+	Total      uint64 // the sum of squared differences between Target and Current
+	tileGrid   int    // the grid size of tileCells; see StepTiles
 }
 
 func NewModel(target image.Image, background *Color, size, numWorkers int) *Model {
 	w := target.Bounds().Size().X
 	h := target.Bounds().Size().Y
-	aspect := float64(w) / float64(h)
-	var sw, sh int
-	var scale float64
-	if aspect >= 1 {
-		sw = size
-		sh = int(float64(size) / aspect)
-		scale = float64(size) / float64(w)
-	} else {
-		sw = int(float64(size) * aspect)
-		sh = size
-		scale = float64(size) / float64(h)
-	}
+	sw, sh, scale := outputSize(w, h, size)
 
 	targetRGBA := imageToRGBA(target)
 	current := uniformRGBA(target.Bounds(), background.NRGBA())
+	rows := rowErrors(targetRGBA, current)
+	total := sumRows(rows)
 	model := &Model{
 		Sw:         sw,
 		Sh:         sh,
@@ -50,12 +55,21 @@ func NewModel(target image.Image, background *Color, size, numWorkers int) *Mode
 		Background: background,
 		Target:     targetRGBA,
 		Current:    current,
-		Score:      differenceFull(targetRGBA, current),
+		Score:      errorScore(total, w, h),
+		Total:      total,
+		rows:       rows,
 		Context:    newModelContext(sw, sh, scale, background.NRGBA()),
 		Shapes:     nil,
 		Colors:     nil,
+		Gradients:  nil,
 		Scores:     nil,
 		Workers:    nil,
+		Limiter:    nil,
+		OnAdd:      nil,
+		pool:       nil,
+		rnd:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		tileGrid:   0,
+		tileCells:  nil,
 	}
 	for i := 0; i < numWorkers; i++ {
 		worker := NewWorker(model.Target)
@@ -64,6 +78,32 @@ func NewModel(target image.Image, background *Color, size, numWorkers int) *Mode
 	return model
 }
 
+// outputSize fits a w x h image into a size x size square, returning the
+// output dimensions and the scale factor from input to output pixels.
+func outputSize(w, h, size int) (sw, sh int, scale float64) {
+	aspect := float64(w) / float64(h)
+	if aspect >= 1 {
+		sw = size
+		sh = int(float64(size) / aspect)
+		scale = float64(size) / float64(w)
+	} else {
+		sw = int(float64(size) * aspect)
+		sh = size
+		scale = float64(size) / float64(h)
+	}
+	return
+}
+
+// Seed makes the model's random choices repeatable. Each hill climb gets
+// its own source derived from seed, so results do not depend on the worker
+// count either.
+func (model *Model) Seed(seed int64) {
+	model.rnd = rand.New(rand.NewSource(seed))
+	for i, worker := range model.Workers {
+		worker.Rnd = rand.New(rand.NewSource(seed + int64(i)))
+	}
+}
+
 func newModelContext(sw, sh int, scale float64, color color.NRGBA) *gg.Context {
 	dc := gg.NewContext(sw, sh)
 	dc.Scale(scale, scale)
@@ -79,10 +119,7 @@ func (model *Model) Frames(scoreDelta float64) []image.Image {
 	result = append(result, imageToRGBA(dc.Image()))
 	previous := 10.0
 	for i, shape := range model.Shapes {
-		c := model.Colors[i]
-		dc.SetRGBA255(c.R, c.G, c.B, c.A)
-		shape.Draw(dc, model.Scale)
-		dc.Fill()
+		drawShape(dc, shape, model.Colors[i], model.Gradients[i], model.blend(), model.Scale)
 		score := model.Scores[i]
 		delta := previous - score
 		if delta >= scoreDelta {
@@ -100,11 +137,26 @@ func (model *Model) SVG() string {
 	fmt.Fprintln(b)
 	fmt.Fprintf(b, `<rect x="0" y="0" width="%d" height="%d" fill="#%02x%02x%02x" />`, model.Sw, model.Sh, bg.R, bg.G, bg.B)
 	fmt.Fprintln(b)
+	model.writeSVGDefs(b)
 	fmt.Fprintf(b, `<g transform="scale(%f) translate(0.5 0.5)">`, model.Scale)
 	fmt.Fprintln(b)
 	for i, shape := range model.Shapes {
 		c := model.Colors[i]
-		attrs := fmt.Sprintf(`fill="#%02x%02x%02x" fill-opacity="%f"`, c.R, c.G, c.B, float64(c.A)/255)
+		paint := "fill"
+		outline := shapeOutline(shape)
+		if outline > 0 {
+			paint = "stroke"
+		}
+		attrs := fmt.Sprintf(`%s="#%02x%02x%02x" %s-opacity="%f"`, paint, c.R, c.G, c.B, paint, float64(c.A)/255)
+		if model.Gradients[i] != nil {
+			attrs = fmt.Sprintf(`%s="url(#%s)"`, paint, svgGradientID(i))
+		}
+		if blend := model.blend(); blend != BlendNormal {
+			attrs += fmt.Sprintf(` style="mix-blend-mode: %s"`, svgBlendModes[blend])
+		}
+		if outline > 0 {
+			attrs += outlineSVG(outline)
+		}
 		fmt.Fprint(b, shape.SVG(attrs))
 		fmt.Fprintln(b)
 	}
@@ -113,36 +165,161 @@ func (model *Model) SVG() string {
 	return b.String()
 }
 
+// svgDefiner is implemented by shapes whose SVG refers to a definition
+// shared by every shape of the kind, such as the sprite of a stamp.
+type svgDefiner interface {
+	svgDefID() string
+	svgDefs() string
+}
+
+// writeSVGDefs writes the definitions shared by shapes of a kind, then one
+// gradient for each shape that has one.
+func (model *Model) writeSVGDefs(b *strings.Builder) {
+	var defs []string
+	seen := make(map[string]bool)
+	for _, shape := range model.Shapes {
+		d, ok := shape.(svgDefiner)
+		if !ok {
+			continue
+		}
+		id := d.svgDefID()
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		defs = append(defs, d.svgDefs())
+	}
+	for i, g := range model.Gradients {
+		if g != nil {
+			defs = append(defs, g.svg(svgGradientID(i), model.Colors[i], model.Shapes[i]))
+		}
+	}
+	if len(defs) == 0 {
+		return
+	}
+	fmt.Fprintln(b, "<defs>")
+	for _, def := range defs {
+		fmt.Fprintln(b, def)
+	}
+	fmt.Fprintln(b, "</defs>")
+}
+
+func svgGradientID(i int) string {
+	return fmt.Sprintf("gradient%d", i)
+}
+
 func (model *Model) Add(shape Shape, alpha int) {
-	before := copyRGBA(model.Current)
 	lines := shape.Rasterize()
-	color := computeColor(model.Target, model.Current, lines, alpha)
-	drawLines(model.Current, color, lines)
-	score := differencePartial(model.Target, before, model.Current, model.Score, lines)
+	color, gradient := computePaint(model.Target, model.Current, lines, alpha, &model.Workers[0].Options)
+	// keep the pixels beneath the shape to measure the change against
+	before := model.Workers[0].Buffer
+	copyLines(before, model.Current, lines)
+	drawPaint(model.Current, color, gradient, model.blend(), lines)
+	for _, line := range lines {
+		delta := differenceLine(model.Target, before, model.Current, line)
+		model.rows[line.Y] = uint64(int64(model.rows[line.Y]) + delta)
+		model.Total = uint64(int64(model.Total) + delta)
+	}
+	score := model.score()
+	if model.Workers[0].Options.Anneal {
+		model.anneal(lines)
+	}
 
 	model.Score = score
 	model.Shapes = append(model.Shapes, shape)
 	model.Colors = append(model.Colors, color)
+	model.Gradients = append(model.Gradients, gradient)
 	model.Scores = append(model.Scores, score)
 
-	model.Context.SetRGBA255(color.R, color.G, color.B, color.A)
-	shape.Draw(model.Context, model.Scale)
+	drawShape(model.Context, shape, color, gradient, model.blend(), model.Scale)
+
+	if len(model.Shapes)%errorCheckInterval == 0 && !model.checkError() {
+		slog.Warn("model error total drifted from its canvas and was recomputed", slog.Int("shapes", len(model.Shapes)))
+		model.Score = model.score()
+		model.Scores[len(model.Scores)-1] = model.Score
+		score = model.Score
+	}
+
+	if model.OnAdd != nil {
+		model.OnAdd(shape, color, gradient, score)
+	}
+}
+
+// errorCheckInterval is how many shapes Add adds between checks of the
+// model's error total against its canvas.
+const errorCheckInterval = 500
+
+// score returns the score of the model's error total.
+func (model *Model) score() float64 {
+	size := model.Current.Bounds().Size()
+	return errorScore(model.Total, size.X, size.Y)
+}
+
+// checkError recomputes the error of every row of the canvas and reports
+// whether the totals kept by Add matched. Adding shapes updates them
+// exactly, so a mismatch means the canvas was changed some other way; the
+// recomputed totals are kept either way.
+func (model *Model) checkError() bool {
+	rows := rowErrors(model.Target, model.Current)
+	total := sumRows(rows)
+	ok := total == model.Total && slices.Equal(rows, model.rows)
+	model.rows, model.Total = rows, total
+	return ok
+}
+
+// RowError returns the sum of squared differences between the target and
+// the canvas over rows y0 up to but not including y1.
+func (model *Model) RowError(y0, y1 int) uint64 {
+	return sumRows(model.rows[max(y0, 0):min(y1, len(model.rows))])
+}
+
+func sumRows(rows []uint64) uint64 {
+	var total uint64
+	for _, row := range rows {
+		total += row
+	}
+	return total
+}
+
+// blend returns the blend mode the model's shapes are drawn with.
+func (model *Model) blend() BlendMode {
+	return model.Workers[0].Options.Blend
+}
+
+// anneal moves the workers' StepScale toward the size of the shape just
+// added, relative to the 32 pixel shapes spawned on a 256 pixel canvas, so
+// that once the shapes found get small, new shapes are spawned small and
+// moved in small steps. The scale is a moving average over roughly the
+// last ten shapes and stays between 1/8 and 1.
+func (model *Model) anneal(lines []Scanline) {
+	area := 0
+	for _, line := range lines {
+		area += line.X2 - line.X1 + 1
+	}
+	for _, worker := range model.Workers {
+		size := clamp(math.Sqrt(float64(area))/(32*worker.canvasScale()), 0.125, 1)
+		worker.StepScale = worker.StepScale*0.9 + size*0.1
+	}
 }
 
 func (model *Model) Step(ctx context.Context, shapeType ShapeType, alpha, repeat int) int {
 	state := model.runWorkers(ctx, shapeType, alpha, 1000, 100, 16)
 	// state = HillClimb(state, 1000).(*State)
-	model.Add(state.Shape, state.Alpha)
-
-	for range repeat {
-		state.Worker.Init(model.Current, model.Score)
-		a := state.Energy()
-		state, _ = HillClimb(state, 100).(*State)
-		b := state.Energy()
-		if a == b {
-			break
-		}
+	// skip the step if no climb found a shape that meets its constraints
+	if !math.IsInf(state.Energy(), 1) {
 		model.Add(state.Shape, state.Alpha)
+
+		for range repeat {
+			// unlike Init, keep the statistics gathered so far in this step
+			state.Worker.Current, state.Worker.Total, state.Worker.Score = model.Current, model.Total, model.Score
+			a := state.Energy()
+			state, _ = HillClimb(state, 100).(*State)
+			b := state.Energy()
+			if a == b {
+				break
+			}
+			model.Add(state.Shape, state.Alpha)
+		}
 	}
 
 	// for _, w := range model.Workers[1:] {
@@ -157,31 +334,27 @@ func (model *Model) Step(ctx context.Context, shapeType ShapeType, alpha, repeat
 	return counter
 }
 
+// runWorkers runs m hill climbs on the model's worker pool and returns the
+// best state found.
 func (model *Model) runWorkers(ctx context.Context, t ShapeType, a, n, age, m int) *State {
-	wn := len(model.Workers)
-	ch := make(chan *State, wn)
-	wm := m / wn
-	if m%wn != 0 {
-		wm++
-	}
-	for i := range wn {
-		worker := model.Workers[i]
-		worker.Init(model.Current, model.Score)
-		go model.runWorker(ctx, worker, t, a, n, age, wm, ch)
-	}
-	var bestEnergy float64
-	var bestState *State
-	for i := range wn {
-		state := <-ch
-		energy := state.Energy()
-		if i == 0 || energy < bestEnergy {
-			bestEnergy = energy
-			bestState = state
-		}
+	if model.pool == nil {
+		model.pool = newPool(model)
 	}
-	return bestState
+	for _, worker := range model.Workers {
+		worker.Init(model.Current, model.Total)
+	}
+	tasks := make([]climbTask, m)
+	for i := range tasks {
+		tasks[i] = climbTask{index: i, seed: model.rnd.Int63(), t: t, alpha: a, n: n, age: age, worker: nil}
+	}
+	return bestState(model.pool.run(ctx, tasks))
 }
 
-func (model *Model) runWorker(ctx context.Context, worker *Worker, t ShapeType, a, n, age, m int, ch chan *State) {
-	ch <- worker.BestHillClimbState(ctx, t, a, n, age, m)
+// Close stops the goroutines that run the model's hill climbs. Run closes
+// the model when it returns; stepping the model again starts them anew.
+func (model *Model) Close() {
+	if model.pool != nil {
+		model.pool.close()
+		model.pool = nil
+	}
 }
@@ -0,0 +1,201 @@
+package primitive
+
+import (
+	"fmt"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/raster"
+)
+
+// ShapeOptions holds the settings workers use when generating random
+// shapes. They are fixed for a run; shapes copy what they need, so changing
+// the options does not affect shapes that already exist.
+type ShapeOptions struct {
+	Font   *Font   // required by glyph shapes
+	Sprite *Sprite // required by stamp shapes
+	// Constraints limits the shapes of each type; types that are not in
+	// the map use DefaultConstraints.
+	Constraints map[ShapeType]Constraints
+	// Palette restricts the colors of shapes to its colors. Nil allows any
+	// color.
+	Palette  *Palette
+	LineCap  LineCap
+	LineJoin LineJoin
+	// PolygonOrder is the number of vertices of polygons and of sides or
+	// points of regular polygons and stars. Zero uses 4, 6 and 5.
+	PolygonOrder int
+	// Fill selects whether shapes are painted with one color or with a
+	// two-stop gradient.
+	Fill Fill
+	// Blend is how shapes combine with the image beneath them.
+	Blend BlendMode
+	// AlphaMin and AlphaMax bound the alpha of shapes whose alpha is
+	// solved, which it is when a stage's alpha is zero.
+	AlphaMin int
+	AlphaMax int
+	// Outline is the stroke width triangles, polygons and ellipses are
+	// outlined with instead of being filled. Zero fills them.
+	Outline       float64
+	PolygonConvex bool // keep polygons convex
+	// Anneal shrinks spawn and mutation distances as the shapes being
+	// added get smaller. See Model.anneal.
+	Anneal bool
+}
+
+func DefaultShapeOptions() ShapeOptions {
+	return ShapeOptions{
+		Font:          nil,
+		Sprite:        nil,
+		Constraints:   nil,
+		Palette:       nil,
+		LineCap:       LineCapRound,
+		LineJoin:      LineJoinRound,
+		PolygonOrder:  0,
+		Fill:          FillFlat,
+		Blend:         BlendNormal,
+		AlphaMin:      1,
+		AlphaMax:      255,
+		Outline:       0,
+		PolygonConvex: false,
+		Anneal:        false,
+	}
+}
+
+// polygonOrder returns the number of vertices, sides or points for random
+// shapes of type t.
+func (opts ShapeOptions) polygonOrder(t ShapeType) int {
+	if opts.PolygonOrder > 0 {
+		return opts.PolygonOrder
+	}
+	switch t {
+	case ShapeTypeRegularPolygon:
+		return 6
+	case ShapeTypeStar:
+		return 5
+	default:
+		return 4
+	}
+}
+
+// SetShapeOptions sets the options used by every worker of the model.
+func (model *Model) SetShapeOptions(opts ShapeOptions) {
+	for _, worker := range model.Workers {
+		worker.Options = opts
+	}
+}
+
+type LineCap int
+
+const (
+	LineCapRound LineCap = iota
+	LineCapButt
+	LineCapSquare
+)
+
+var lineCapNames = []string{"round", "butt", "square"}
+
+func (c LineCap) String() string {
+	if c >= 0 && int(c) < len(lineCapNames) {
+		return lineCapNames[c]
+	}
+	return fmt.Sprintf("LineCap(%d)", int(c))
+}
+
+func ParseLineCap(name string) (LineCap, error) {
+	for i, n := range lineCapNames {
+		if n == name {
+			return LineCap(i), nil
+		}
+	}
+	return LineCapRound, fmt.Errorf("unknown line cap: %q", name)
+}
+
+func (c LineCap) capper() raster.Capper {
+	switch c {
+	case LineCapButt:
+		return raster.ButtCapper
+	case LineCapSquare:
+		return raster.SquareCapper
+	default:
+		return raster.RoundCapper
+	}
+}
+
+func (c LineCap) gg() gg.LineCap {
+	switch c {
+	case LineCapButt:
+		return gg.LineCapButt
+	case LineCapSquare:
+		return gg.LineCapSquare
+	default:
+		return gg.LineCapRound
+	}
+}
+
+// Fill is how a shape is painted: with the single color that best fits
+// the pixels it covers, or with a linear or radial gradient between two
+// fitted colors.
+type Fill int
+
+const (
+	FillFlat Fill = iota
+	FillLinear
+	FillRadial
+)
+
+var fillNames = []string{"flat", "linear", "radial"}
+
+func (f Fill) String() string {
+	if f >= 0 && int(f) < len(fillNames) {
+		return fillNames[f]
+	}
+	return fmt.Sprintf("Fill(%d)", int(f))
+}
+
+func ParseFill(name string) (Fill, error) {
+	for i, n := range fillNames {
+		if n == name {
+			return Fill(i), nil
+		}
+	}
+	return FillFlat, fmt.Errorf("unknown fill: %q", name)
+}
+
+type LineJoin int
+
+const (
+	LineJoinRound LineJoin = iota
+	LineJoinBevel
+)
+
+var lineJoinNames = []string{"round", "bevel"}
+
+func (j LineJoin) String() string {
+	if j >= 0 && int(j) < len(lineJoinNames) {
+		return lineJoinNames[j]
+	}
+	return fmt.Sprintf("LineJoin(%d)", int(j))
+}
+
+func ParseLineJoin(name string) (LineJoin, error) {
+	for i, n := range lineJoinNames {
+		if n == name {
+			return LineJoin(i), nil
+		}
+	}
+	return LineJoinRound, fmt.Errorf("unknown line join: %q", name)
+}
+
+func (j LineJoin) joiner() raster.Joiner {
+	if j == LineJoinBevel {
+		return raster.BevelJoiner
+	}
+	return raster.RoundJoiner
+}
+
+func (j LineJoin) gg() gg.LineJoin {
+	if j == LineJoinBevel {
+		return gg.LineJoinBevel
+	}
+	return gg.LineJoinRound
+}
@@ -0,0 +1,96 @@
+package primitive
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/raster"
+)
+
+// Triangles, polygons and ellipses can be drawn as outlines instead of
+// filled. Their Outline field is the stroke width, and zero fills them.
+// The outline is what gets rasterized, so it is what the optimizer scores.
+
+// strokeOutline rasterizes the outline of a closed path with round joins.
+func strokeOutline(worker *Worker, path raster.Path, width float64) []Scanline {
+	return strokePath(worker, path, fix(width), raster.RoundCapper, raster.RoundJoiner)
+}
+
+// fillOrStroke fills the current path of dc, or strokes it with round
+// joins if outline is not zero. The stroke settings are left on dc, so
+// callers push and pop the context around the shape.
+func fillOrStroke(dc *gg.Context, outline, scale float64) {
+	if outline == 0 {
+		dc.Fill()
+		return
+	}
+	dc.SetLineWidth(outline * scale)
+	dc.SetLineCap(gg.LineCapRound)
+	dc.SetLineJoin(gg.LineJoinRound)
+	dc.Stroke()
+}
+
+// outliner is implemented by shapes that can be drawn as outlines.
+type outliner interface {
+	outlineWidth() float64
+}
+
+// shapeOutline returns the stroke width shape is outlined with, or zero if
+// it is filled.
+func shapeOutline(shape Shape) float64 {
+	if o, ok := shape.(outliner); ok {
+		return o.outlineWidth()
+	}
+	return 0
+}
+
+// outlineSVG returns the attributes that leave a shape unfilled and round
+// the joins of its outline. Model.SVG paints the outline with the stroke
+// attributes in place of the fill ones.
+func outlineSVG(outline float64) string {
+	return fmt.Sprintf(` fill="none" stroke-width="%f" stroke-linejoin="round"`, outline)
+}
+
+// closedPath returns the path through the points, back to the first.
+func closedPath(x, y []float64) raster.Path {
+	var path raster.Path
+	for i := 0; i <= len(x); i++ {
+		f := fixp(x[i%len(x)], y[i%len(y)])
+		if i == 0 {
+			path.Start(f)
+		} else {
+			path.Add1(f)
+		}
+	}
+	return path
+}
+
+// ellipsePath returns an ellipse centered on x, y and rotated by angle
+// degrees, approximated by 16 quadratic segments.
+func ellipsePath(x, y, rx, ry, angle float64) raster.Path {
+	var path raster.Path
+	const n = 16
+	for i := 0; i < n; i++ {
+		p1 := float64(i+0) / n
+		p2 := float64(i+1) / n
+		a1 := p1 * 2 * math.Pi
+		a2 := p2 * 2 * math.Pi
+		x0 := rx * math.Cos(a1)
+		y0 := ry * math.Sin(a1)
+		x1 := rx * math.Cos(a1+(a2-a1)/2)
+		y1 := ry * math.Sin(a1+(a2-a1)/2)
+		x2 := rx * math.Cos(a2)
+		y2 := ry * math.Sin(a2)
+		cx := 2*x1 - x0/2 - x2/2
+		cy := 2*y1 - y0/2 - y2/2
+		x0, y0 = rotate(x0, y0, radians(angle))
+		cx, cy = rotate(cx, cy, radians(angle))
+		x2, y2 = rotate(x2, y2, radians(angle))
+		if i == 0 {
+			path.Start(fixp(x0+x, y0+y))
+		}
+		path.Add2(fixp(cx+x, cy+y), fixp(x2+x, y2+y))
+	}
+	return path
+}
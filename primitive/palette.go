@@ -0,0 +1,234 @@
+package primitive
+
+import (
+	"errors"
+	"image"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+// Palette is a fixed set of colors that shapes are painted with. The
+// optimal color of each shape is replaced by the palette color nearest to
+// it in CIELAB space, where distances follow perceived differences more
+// closely than in RGB.
+type Palette struct {
+	Colors []Color
+	lab    [][3]float64
+}
+
+func NewPalette(colors []Color) *Palette {
+	p := &Palette{Colors: make([]Color, len(colors)), lab: make([][3]float64, len(colors))}
+	for i, c := range colors {
+		c.A = 255
+		p.Colors[i] = c
+		p.lab[i] = colorToLab(c)
+	}
+	return p
+}
+
+// ParsePalette reads hex colors separated by commas or white space.
+func ParsePalette(s string) (*Palette, error) {
+	fields := strings.Fields(strings.ReplaceAll(s, ",", " "))
+	if len(fields) == 0 {
+		return nil, errors.New("palette has no colors")
+	}
+	colors := make([]Color, len(fields))
+	for i, field := range fields {
+		c, err := MakeHexColor(field)
+		if err != nil {
+			return nil, err
+		}
+		colors[i] = *c
+	}
+	return NewPalette(colors), nil
+}
+
+// LoadPalette reads a palette from a file of hex colors, or from arg itself
+// if there is no such file.
+func LoadPalette(arg string) (*Palette, error) {
+	data, err := os.ReadFile(arg)
+	if errors.Is(err, os.ErrNotExist) {
+		return ParsePalette(arg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParsePalette(string(data))
+}
+
+// Nearest returns the palette color closest to c, with c's alpha.
+func (p *Palette) Nearest(c Color) Color {
+	lab := colorToLab(c)
+	best, bestDistance := 0, math.Inf(1)
+	for i, q := range p.lab {
+		d := labDistance(lab, q)
+		if d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+	result := p.Colors[best]
+	result.A = c.A
+	return result
+}
+
+// ExtractPalette picks k colors that represent im by k-means clustering of
+// its pixels in CIELAB space. The clustering starts from a fixed seed, so
+// the same image always gives the same palette.
+func ExtractPalette(im image.Image, k int) *Palette {
+	rgba := imageToRGBA(im)
+	size := rgba.Bounds().Size()
+	// large images are sampled; the clusters do not need every pixel
+	step := maxInt(1, int(math.Sqrt(float64(size.X*size.Y)/65536)))
+	var points [][3]float64
+	for y := 0; y < size.Y; y += step {
+		for x := 0; x < size.X; x += step {
+			c := rgba.RGBAAt(x, y)
+			points = append(points, colorToLab(Color{int(c.R), int(c.G), int(c.B), 255}))
+		}
+	}
+	centers := kmeans(points, k, rand.New(rand.NewSource(1)))
+	colors := make([]Color, 0, len(centers))
+	seen := make(map[Color]bool)
+	for _, center := range centers {
+		c := labToColor(center)
+		if !seen[c] {
+			seen[c] = true
+			colors = append(colors, c)
+		}
+	}
+	return NewPalette(colors)
+}
+
+// kmeans clusters points into at most k groups, seeded with k-means++, and
+// returns the center of each.
+func kmeans(points [][3]float64, k int, rnd *rand.Rand) [][3]float64 {
+	k = minInt(k, len(points))
+	if k < 1 {
+		return nil
+	}
+	centers := [][3]float64{points[rnd.Intn(len(points))]}
+	distances := make([]float64, len(points))
+	for len(centers) < k {
+		total := 0.0
+		for i, p := range points {
+			distances[i] = math.Inf(1)
+			for _, c := range centers {
+				distances[i] = math.Min(distances[i], labDistance(p, c))
+			}
+			total += distances[i]
+		}
+		if total == 0 {
+			break // fewer distinct colors than k
+		}
+		r := rnd.Float64() * total
+		i := 0
+		for ; i < len(points)-1 && r >= distances[i]; i++ {
+			r -= distances[i]
+		}
+		centers = append(centers, points[i])
+	}
+	assignments := make([]int, len(points))
+	for iteration := 0; iteration < 32; iteration++ {
+		changed := false
+		for i, p := range points {
+			best, bestDistance := 0, math.Inf(1)
+			for j, c := range centers {
+				if d := labDistance(p, c); d < bestDistance {
+					best, bestDistance = j, d
+				}
+			}
+			if iteration == 0 || assignments[i] != best {
+				assignments[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+		sums := make([][3]float64, len(centers))
+		counts := make([]int, len(centers))
+		for i, p := range points {
+			j := assignments[i]
+			for c := range 3 {
+				sums[j][c] += p[c]
+			}
+			counts[j]++
+		}
+		for j := range centers {
+			if counts[j] > 0 {
+				for c := range 3 {
+					centers[j][c] = sums[j][c] / float64(counts[j])
+				}
+			}
+		}
+	}
+	return centers
+}
+
+// labDistance is the squared CIE76 color difference.
+func labDistance(a, b [3]float64) float64 {
+	dl, da, db := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dl*dl + da*da + db*db
+}
+
+// D65 white point
+const (
+	labXn = 0.95047
+	labYn = 1.0
+	labZn = 1.08883
+)
+
+func colorToLab(c Color) [3]float64 {
+	r := srgbToLinear(float64(c.R) / 255)
+	g := srgbToLinear(float64(c.G) / 255)
+	b := srgbToLinear(float64(c.B) / 255)
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / labXn
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*b) / labYn
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / labZn
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+func labToColor(lab [3]float64) Color {
+	fy := (lab[0] + 16) / 116
+	fx := fy + lab[1]/500
+	fz := fy - lab[2]/200
+	x, y, z := labFInverse(fx)*labXn, labFInverse(fy)*labYn, labFInverse(fz)*labZn
+	r := 3.2404542*x - 1.5371385*y - 0.4985314*z
+	g := -0.9692660*x + 1.8760108*y + 0.0415560*z
+	b := 0.0556434*x - 0.2040259*y + 1.0572252*z
+	channel := func(v float64) int {
+		return clampInt(int(math.Round(linearToSRGB(clamp(v, 0, 1))*255)), 0, 255)
+	}
+	return Color{channel(r), channel(g), channel(b), 255}
+}
+
+func labF(t float64) float64 {
+	if t > 216.0/24389 {
+		return math.Cbrt(t)
+	}
+	return (24389.0/27*t + 16) / 116
+}
+
+func labFInverse(t float64) float64 {
+	if t3 := t * t * t; t3 > 216.0/24389 {
+		return t3
+	}
+	return (116*t - 16) * 27 / 24389
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
@@ -0,0 +1,112 @@
+package primitive
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParsePalette(t *testing.T) {
+	t.Parallel()
+	p, err := ParsePalette("#ff0000, 00ff00\n#00f\t#12345680")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Color{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {0x12, 0x34, 0x56, 255}}
+	if !slices.Equal(p.Colors, want) {
+		t.Errorf("got %v, want %v", p.Colors, want)
+	}
+	for _, s := range []string{"", " , ", "#ff0000 red"} {
+		if _, err := ParsePalette(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestLoadPalette(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "colors.txt")
+	if err := os.WriteFile(path, []byte("#000000\n#ffffff\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, arg := range []string{path, "#000,#fff"} {
+		p, err := LoadPalette(arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []Color{{0, 0, 0, 255}, {255, 255, 255, 255}}; !slices.Equal(p.Colors, want) {
+			t.Errorf("%s: got %v, want %v", arg, p.Colors, want)
+		}
+	}
+}
+
+func TestPaletteNearest(t *testing.T) {
+	t.Parallel()
+	p := NewPalette([]Color{{0, 0, 0, 255}, {128, 128, 128, 255}, {255, 255, 255, 255}, {220, 40, 40, 255}})
+	tests := []struct {
+		in, want Color
+	}{
+		{Color{10, 5, 0, 128}, Color{0, 0, 0, 128}},
+		{Color{240, 250, 255, 255}, Color{255, 255, 255, 255}},
+		{Color{200, 60, 30, 64}, Color{220, 40, 40, 64}},
+		// closer to black than to gray in RGB, but not to the eye
+		{Color{80, 80, 80, 255}, Color{128, 128, 128, 255}},
+	}
+	for _, tt := range tests {
+		if got := p.Nearest(tt.in); got != tt.want {
+			t.Errorf("Nearest(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLabRoundTrip(t *testing.T) {
+	t.Parallel()
+	for _, c := range []Color{{0, 0, 0, 255}, {255, 255, 255, 255}, {12, 200, 99, 255}, {255, 0, 128, 255}} {
+		if got := labToColor(colorToLab(c)); got != c {
+			t.Errorf("got %v, want %v", got, c)
+		}
+	}
+}
+
+func TestExtractPalette(t *testing.T) {
+	t.Parallel()
+	want := []Color{{200, 30, 40, 255}, {20, 90, 160, 255}, {240, 230, 200, 255}}
+	im := image.NewRGBA(image.Rect(0, 0, 30, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 30; x++ {
+			c := want[x/10]
+			im.SetRGBA(x, y, color.RGBA{uint8(c.R), uint8(c.G), uint8(c.B), 255})
+		}
+	}
+	got := ExtractPalette(im, 3).Colors
+	for _, c := range want {
+		if !slices.Contains(got, c) {
+			t.Errorf("palette %v is missing %v", got, c)
+		}
+	}
+	if got := ExtractPalette(im, 8).Colors; len(got) != 3 {
+		t.Errorf("got %d colors from an image with 3", len(got))
+	}
+}
+
+func TestComputePaintPalette(t *testing.T) {
+	t.Parallel()
+	bounds := image.Rect(0, 0, 8, 8)
+	target := uniformRGBA(bounds, color.NRGBA{170, 50, 60, 255})
+	current := uniformRGBA(bounds, color.NRGBA{255, 255, 255, 255})
+	opts := DefaultShapeOptions()
+	opts.Palette = NewPalette([]Color{{0, 0, 0, 255}, {200, 30, 40, 255}})
+	for _, fill := range []Fill{FillFlat, FillLinear} {
+		opts.Fill = fill
+		c, g := computePaint(target, current, fullLines(8, 8), 255, &opts)
+		if c != (Color{200, 30, 40, 255}) {
+			t.Errorf("%s: got %v, want the red palette color", fill, c)
+		}
+		if g != nil && g.Color != c {
+			t.Errorf("%s: gradient ends at %v, want %v", fill, g.Color, c)
+		}
+	}
+}
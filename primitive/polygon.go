@@ -5,44 +5,49 @@ import (
 	"strings"
 
 	"github.com/fogleman/gg"
-	"github.com/golang/freetype/raster"
 )
 
 type Polygon struct {
-	Worker *Worker
-	X      []float64
-	Y      []float64
-	Order  int
-	Convex bool
+	Worker  *Worker
+	X       []float64
+	Y       []float64
+	Order   int
+	Convex  bool
+	Outline float64
 }
 
 func NewRandomPolygon(worker *Worker, order int, convex bool) *Polygon {
 	rnd := worker.Rnd
+	s := worker.spawnScale()
 	x := make([]float64, order)
 	y := make([]float64, order)
 	x[0] = rnd.Float64() * float64(worker.W)
 	y[0] = rnd.Float64() * float64(worker.H)
 	for i := 1; i < order; i++ {
-		x[i] = x[0] + rnd.Float64()*40 - 20
-		y[i] = y[0] + rnd.Float64()*40 - 20
+		x[i] = x[0] + (rnd.Float64()*40-20)*s
+		y[i] = y[0] + (rnd.Float64()*40-20)*s
 	}
-	p := &Polygon{Worker: worker, Order: order, Convex: convex, X: x, Y: y}
+	p := &Polygon{Worker: worker, Order: order, Convex: convex, X: x, Y: y, Outline: worker.Options.Outline}
 	p.Mutate()
 	return p
 }
 
 func (p *Polygon) Draw(dc *gg.Context, scale float64) {
+	dc.Push()
 	dc.NewSubPath()
 	for i := 0; i < p.Order; i++ {
 		dc.LineTo(p.X[i], p.Y[i])
 	}
 	dc.ClosePath()
-	dc.Fill()
+	fillOrStroke(dc, p.Outline, scale)
+	dc.Pop()
 }
 
+// SVG marks the polygon with a data-shape attribute, as ReadSVG would
+// otherwise read a polygon of three vertices as a triangle.
 func (p *Polygon) SVG(attrs string) string {
 	ret := fmt.Sprintf(
-		"<polygon %s points=\"",
+		"<polygon %s data-shape=\"polygon\" points=\"",
 		attrs)
 	points := make([]string, len(p.X))
 	for i := 0; i < len(p.X); i++ {
@@ -52,6 +57,10 @@ func (p *Polygon) SVG(attrs string) string {
 	return ret + strings.Join(points, ",") + "\" />"
 }
 
+func (p *Polygon) outlineWidth() float64 {
+	return p.Outline
+}
+
 func (p *Polygon) Copy() Shape {
 	a := *p
 	a.X = make([]float64, p.Order)
@@ -62,27 +71,35 @@ func (p *Polygon) Copy() Shape {
 }
 
 func (p *Polygon) Mutate() {
-	const m = 16
 	w := p.Worker.W
 	h := p.Worker.H
 	rnd := p.Worker.Rnd
-	for {
+	limits := p.Worker.constraints(ShapeTypePolygon)
+	m := limits.Margin
+	saved, _ := p.Copy().(*Polygon)
+	for range mutateTries {
 		if rnd.Float64() < 0.25 {
 			i := rnd.Intn(p.Order)
 			j := rnd.Intn(p.Order)
 			p.X[i], p.Y[i], p.X[j], p.Y[j] = p.X[j], p.Y[j], p.X[i], p.Y[i]
 		} else {
 			i := rnd.Intn(p.Order)
-			p.X[i] = clamp(p.X[i]+rnd.NormFloat64()*16, -m, float64(w-1+m))
-			p.Y[i] = clamp(p.Y[i]+rnd.NormFloat64()*16, -m, float64(h-1+m))
+			p.X[i] = clamp(p.X[i]+rnd.NormFloat64()*limits.Step, -m, float64(w-1)+m)
+			p.Y[i] = clamp(p.Y[i]+rnd.NormFloat64()*limits.Step, -m, float64(h-1)+m)
 		}
 		if p.Valid() {
-			break
+			return
 		}
 	}
+	*p = *saved
 }
 
+// Valid checks the polygon against its size and aspect constraints and,
+// if it must be convex, its convexity.
 func (p *Polygon) Valid() bool {
+	if !p.Worker.constraints(ShapeTypePolygon).fitsPoints(p.X, p.Y) {
+		return false
+	}
 	if !p.Convex {
 		return true
 	}
@@ -110,14 +127,9 @@ func cross3(x1, y1, x2, y2, x3, y3 float64) float64 {
 }
 
 func (p *Polygon) Rasterize() []Scanline {
-	var path raster.Path
-	for i := 0; i <= p.Order; i++ {
-		f := fixp(p.X[i%p.Order], p.Y[i%p.Order])
-		if i == 0 {
-			path.Start(f)
-		} else {
-			path.Add1(f)
-		}
+	path := closedPath(p.X[:p.Order], p.Y[:p.Order])
+	if p.Outline > 0 {
+		return strokeOutline(p.Worker, path, p.Outline)
 	}
 	return fillPath(p.Worker, path)
 }
@@ -0,0 +1,154 @@
+package primitive
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// climbTask is one hill climb of a step: the best of n random shapes,
+// climbed until age moves fail in a row. Each task has its own random
+// seed, so what it finds does not depend on which worker runs it. Tasks
+// with a worker of their own, such as a tile's, run on it instead of the
+// pool worker that picks them up.
+type climbTask struct {
+	worker *Worker
+	index  int
+	seed   int64
+	t      ShapeType
+	alpha  int
+	n, age int
+}
+
+// taskQueue is a worker's queue of tasks. The owner takes tasks from the
+// front and other workers steal from the back.
+type taskQueue struct {
+	tasks []climbTask
+	mu    sync.Mutex
+}
+
+func (q *taskQueue) pop(steal bool) (climbTask, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := len(q.tasks)
+	if n == 0 {
+		return climbTask{index: 0, seed: 0, t: ShapeTypeAny, alpha: 0, n: 0, age: 0, worker: nil}, false
+	}
+	if steal {
+		task := q.tasks[n-1]
+		q.tasks = q.tasks[:n-1]
+		return task, true
+	}
+	task := q.tasks[0]
+	q.tasks = q.tasks[1:]
+	return task, true
+}
+
+// poolBatch is the tasks of one step, dealt round robin onto the queues
+// of the workers, and the states they find.
+type poolBatch struct {
+	ctx     context.Context
+	queues  []taskQueue
+	results []*State
+	wg      sync.WaitGroup
+}
+
+// next returns the worker's next task: the front of its own queue, or
+// else the back of the first other queue that has one.
+func (b *poolBatch) next(i int) (task climbTask, stolen, ok bool) {
+	if task, ok := b.queues[i].pop(false); ok {
+		return task, false, true
+	}
+	for k := 1; k < len(b.queues); k++ {
+		if task, ok := b.queues[(i+k)%len(b.queues)].pop(true); ok {
+			return task, true, true
+		}
+	}
+	return climbTask{index: 0, seed: 0, t: ShapeTypeAny, alpha: 0, n: 0, age: 0, worker: nil}, false, false
+}
+
+// pool runs the hill climbs of each step on one long-lived goroutine per
+// worker. Each step is a fixed number of tasks however many workers there
+// are, and a worker that runs out of tasks steals from the others, so no
+// worker idles while climbs remain.
+type pool struct {
+	batches []chan *poolBatch
+}
+
+func newPool(model *Model) *pool {
+	p := &pool{batches: make([]chan *poolBatch, len(model.Workers))}
+	for i, worker := range model.Workers {
+		p.batches[i] = make(chan *poolBatch)
+		go model.runPoolWorker(i, worker, p.batches[i])
+	}
+	return p
+}
+
+func (model *Model) runPoolWorker(i int, worker *Worker, batches chan *poolBatch) {
+	for b := range batches {
+		for {
+			task, stolen, ok := b.next(i)
+			if !ok {
+				break
+			}
+			w := worker
+			if task.worker != nil {
+				w = task.worker
+			}
+			model.Limiter.Acquire()
+			start := time.Now()
+			counter := w.Counter
+			w.Rnd = rand.New(rand.NewSource(task.seed))
+			b.results[task.index] = w.BestHillClimbState(b.ctx, task.t, task.alpha, task.n, task.age, 1)
+			if w != worker {
+				worker.Counter += w.Counter - counter
+			}
+			worker.Busy += time.Since(start)
+			worker.Tasks++
+			if stolen {
+				worker.Steals++
+			}
+			model.Limiter.Release()
+		}
+		b.wg.Done()
+	}
+}
+
+// run runs the tasks and returns the state each found.
+func (p *pool) run(ctx context.Context, tasks []climbTask) []*State {
+	b := &poolBatch{
+		ctx:     ctx,
+		queues:  make([]taskQueue, len(p.batches)),
+		results: make([]*State, len(tasks)),
+		wg:      sync.WaitGroup{},
+	}
+	for i, task := range tasks {
+		q := &b.queues[i%len(b.queues)]
+		q.tasks = append(q.tasks, task)
+	}
+	b.wg.Add(len(p.batches))
+	for _, ch := range p.batches {
+		ch <- b
+	}
+	b.wg.Wait()
+	return b.results
+}
+
+// bestState returns the state with the lowest energy, preferring earlier
+// states on ties so that the result does not depend on timing.
+func bestState(states []*State) *State {
+	var best *State
+	for _, state := range states {
+		if best == nil || state.Energy() < best.Energy() {
+			best = state
+		}
+	}
+	return best
+}
+
+func (p *pool) close() {
+	for _, ch := range p.batches {
+		close(ch)
+	}
+}
@@ -0,0 +1,92 @@
+package primitive
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func poolTestModel(workers int) *Model {
+	im := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			im.SetRGBA(x, y, color.RGBA{uint8(x * 8), uint8(y * 8), 128, 255})
+		}
+	}
+	model := NewModel(im, &Color{R: 0, G: 0, B: 0, A: 255}, 32, workers)
+	model.Seed(1)
+	return model
+}
+
+// TestPoolWorkerCount checks that a step runs the same climbs, and so
+// finds the same shape, however many workers share them.
+func TestPoolWorkerCount(t *testing.T) {
+	t.Parallel()
+	const climbs = 7
+	var want []float64
+	for _, workers := range []int{1, 3, 8} {
+		model := poolTestModel(workers)
+		state := model.runWorkers(context.Background(), ShapeTypeTriangle, 128, 20, 10, climbs)
+		model.Close()
+		_, params := encodeShape(state.Shape)
+		if want == nil {
+			want = params
+		} else if !slices.Equal(params, want) {
+			t.Errorf("%d workers: got %v, want %v", workers, params, want)
+		}
+		tasks, steals := 0, 0
+		for _, worker := range model.Workers {
+			tasks += worker.Tasks
+			steals += worker.Steals
+		}
+		if tasks != climbs {
+			t.Errorf("%d workers: ran %d climbs, want %d", workers, tasks, climbs)
+		}
+		if workers == 1 && steals != 0 {
+			t.Errorf("a single worker stole %d climbs", steals)
+		}
+	}
+}
+
+func TestPoolBatchSteal(t *testing.T) {
+	t.Parallel()
+	b := &poolBatch{ctx: context.Background(), queues: make([]taskQueue, 3), results: nil, wg: sync.WaitGroup{}}
+	for i := range 4 {
+		b.queues[0].tasks = append(b.queues[0].tasks, climbTask{index: i, seed: 0, t: ShapeTypeTriangle, alpha: 128, n: 1, age: 1, worker: nil})
+	}
+	var order []int
+	for _, want := range []struct {
+		worker int
+		stolen bool
+	}{{0, false}, {1, true}, {2, true}, {0, false}} {
+		task, stolen, ok := b.next(want.worker)
+		if !ok || stolen != want.stolen {
+			t.Fatalf("worker %d: got stolen %v, ok %v", want.worker, stolen, ok)
+		}
+		order = append(order, task.index)
+	}
+	// the owner takes from the front and thieves from the back
+	if !slices.Equal(order, []int{0, 3, 2, 1}) {
+		t.Errorf("got tasks in order %v", order)
+	}
+	if _, _, ok := b.next(1); ok {
+		t.Error("got a task from empty queues")
+	}
+}
+
+func TestModelClose(t *testing.T) {
+	t.Parallel()
+	model := poolTestModel(2)
+	model.Step(context.Background(), ShapeTypeRectangle, 128, 0)
+	model.Close()
+	model.Close()
+	// stepping again restarts the pool
+	model.Step(context.Background(), ShapeTypeRectangle, 128, 0)
+	model.Close()
+	if len(model.Shapes) != 2 {
+		t.Errorf("got %d shapes, want 2", len(model.Shapes))
+	}
+}
@@ -18,12 +18,13 @@ type Quadratic struct {
 
 func NewRandomQuadratic(worker *Worker) *Quadratic {
 	rnd := worker.Rnd
+	s := worker.spawnScale()
 	x1 := rnd.Float64() * float64(worker.W)
 	y1 := rnd.Float64() * float64(worker.H)
-	x2 := x1 + rnd.Float64()*40 - 20
-	y2 := y1 + rnd.Float64()*40 - 20
-	x3 := x2 + rnd.Float64()*40 - 20
-	y3 := y2 + rnd.Float64()*40 - 20
+	x2 := x1 + (rnd.Float64()*40-20)*s
+	y2 := y1 + (rnd.Float64()*40-20)*s
+	x3 := x2 + (rnd.Float64()*40-20)*s
+	y3 := y2 + (rnd.Float64()*40-20)*s
 	width := 1.0 / 2
 	q := &Quadratic{worker, x1, y1, x2, y2, x3, y3, width}
 	q.Mutate()
@@ -51,31 +52,41 @@ func (q *Quadratic) Copy() Shape {
 }
 
 func (q *Quadratic) Mutate() {
-	const m = 16
 	w := q.Worker.W
 	h := q.Worker.H
 	rnd := q.Worker.Rnd
-	for {
-		switch rnd.Intn(3) {
+	limits := q.Worker.constraints(ShapeTypeQuadratic)
+	m := limits.Margin
+	saved := *q
+	for range mutateTries {
+		switch rnd.Intn(4) {
 		case 0:
-			q.X1 = clamp(q.X1+rnd.NormFloat64()*16, -m, float64(w-1+m))
-			q.Y1 = clamp(q.Y1+rnd.NormFloat64()*16, -m, float64(h-1+m))
+			q.X1 = clamp(q.X1+rnd.NormFloat64()*limits.Step, -m, float64(w-1)+m)
+			q.Y1 = clamp(q.Y1+rnd.NormFloat64()*limits.Step, -m, float64(h-1)+m)
 		case 1:
-			q.X2 = clamp(q.X2+rnd.NormFloat64()*16, -m, float64(w-1+m))
-			q.Y2 = clamp(q.Y2+rnd.NormFloat64()*16, -m, float64(h-1+m))
+			q.X2 = clamp(q.X2+rnd.NormFloat64()*limits.Step, -m, float64(w-1)+m)
+			q.Y2 = clamp(q.Y2+rnd.NormFloat64()*limits.Step, -m, float64(h-1)+m)
 		case 2:
-			q.X3 = clamp(q.X3+rnd.NormFloat64()*16, -m, float64(w-1+m))
-			q.Y3 = clamp(q.Y3+rnd.NormFloat64()*16, -m, float64(h-1+m))
+			q.X3 = clamp(q.X3+rnd.NormFloat64()*limits.Step, -m, float64(w-1)+m)
+			q.Y3 = clamp(q.Y3+rnd.NormFloat64()*limits.Step, -m, float64(h-1)+m)
 		case 3:
-			q.Width = clamp(q.Width+rnd.NormFloat64(), 1, 16)
+			k := q.Worker.canvasScale()
+			q.Width = clamp(q.Width+rnd.NormFloat64()*k, 1, 16*k)
 		}
 		if q.Valid() {
-			break
+			return
 		}
 	}
+	*q = saved
 }
 
+// Valid rejects curves that fold back on themselves or break their size
+// and aspect constraints.
 func (q *Quadratic) Valid() bool {
+	limits := q.Worker.constraints(ShapeTypeQuadratic)
+	if !limits.fitsPoints([]float64{q.X1, q.X2, q.X3}, []float64{q.Y1, q.Y2, q.Y3}) {
+		return false
+	}
 	dx12 := int(q.X1 - q.X2)
 	dy12 := int(q.Y1 - q.Y2)
 	dx23 := int(q.X2 - q.X3)
@@ -44,3 +44,33 @@ func strokePath(worker *Worker, path raster.Path, width fixed.Int26_6, cr raster
 	r.Rasterize(&p)
 	return p.Lines
 }
+
+// addCubic appends the cubic from the current point (x1, y1) to path as n
+// quadratic segments. The freetype stroker cannot stroke cubic segments,
+// so strokes are approximated; filled paths can use Add3 directly.
+func addCubic(path *raster.Path, x1, y1, x2, y2, x3, y3, x4, y4 float64, n int) {
+	point := func(t float64) (x, y float64) {
+		u := 1 - t
+		a, b, c, d := u*u*u, 3*u*u*t, 3*u*t*t, t*t*t
+		return a*x1 + b*x2 + c*x3 + d*x4, a*y1 + b*y2 + c*y3 + d*y4
+	}
+	tangent := func(t float64) (dx, dy float64) {
+		u := 1 - t
+		a, b, c := 3*u*u, 6*u*t, 3*t*t
+		return a*(x2-x1) + b*(x3-x2) + c*(x4-x3), a*(y2-y1) + b*(y3-y2) + c*(y4-y3)
+	}
+	for i := 0; i < n; i++ {
+		t0 := float64(i) / float64(n)
+		t1 := float64(i+1) / float64(n)
+		ax, ay := point(t0)
+		bx, by := point(t1)
+		// the control point of each piece matches the average of the
+		// tangents at its ends
+		dx0, dy0 := tangent(t0)
+		dx1, dy1 := tangent(t1)
+		h := (t1 - t0) / 4
+		cx := (ax + dx0*h + bx - dx1*h) / 2
+		cy := (ay + dy0*h + by - dy1*h) / 2
+		path.Add2(fixp(cx, cy), fixp(bx, by))
+	}
+}
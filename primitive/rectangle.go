@@ -17,9 +17,13 @@ func NewRandomRectangle(worker *Worker) *Rectangle {
 	rnd := worker.Rnd
 	x1 := rnd.Intn(worker.W)
 	y1 := rnd.Intn(worker.H)
-	x2 := clampInt(x1+rnd.Intn(32)+1, 0, worker.W-1)
-	y2 := clampInt(y1+rnd.Intn(32)+1, 0, worker.H-1)
-	return &Rectangle{worker, x1, y1, x2, y2}
+	x2 := clampInt(x1+worker.spawnInt(rnd.Intn(32)+1), 0, worker.W-1)
+	y2 := clampInt(y1+worker.spawnInt(rnd.Intn(32)+1), 0, worker.H-1)
+	r := &Rectangle{worker, x1, y1, x2, y2}
+	if !r.Valid() {
+		r.Mutate()
+	}
+	return r
 }
 
 func (r *Rectangle) bounds() (x1, y1, x2, y2 int) {
@@ -58,14 +62,29 @@ func (r *Rectangle) Mutate() {
 	w := r.Worker.W
 	h := r.Worker.H
 	rnd := r.Worker.Rnd
-	switch rnd.Intn(2) {
-	case 0:
-		r.X1 = clampInt(r.X1+int(rnd.NormFloat64()*16), 0, w-1)
-		r.Y1 = clampInt(r.Y1+int(rnd.NormFloat64()*16), 0, h-1)
-	case 1:
-		r.X2 = clampInt(r.X2+int(rnd.NormFloat64()*16), 0, w-1)
-		r.Y2 = clampInt(r.Y2+int(rnd.NormFloat64()*16), 0, h-1)
+	step := r.Worker.constraints(ShapeTypeRectangle).Step
+	saved := *r
+	for range mutateTries {
+		switch rnd.Intn(2) {
+		case 0:
+			r.X1 = clampInt(r.X1+int(rnd.NormFloat64()*step), 0, w-1)
+			r.Y1 = clampInt(r.Y1+int(rnd.NormFloat64()*step), 0, h-1)
+		case 1:
+			r.X2 = clampInt(r.X2+int(rnd.NormFloat64()*step), 0, w-1)
+			r.Y2 = clampInt(r.Y2+int(rnd.NormFloat64()*step), 0, h-1)
+		}
+		if r.Valid() {
+			return
+		}
 	}
+	*r = saved
+}
+
+// Valid checks the rectangle against its size and aspect constraints.
+func (r *Rectangle) Valid() bool {
+	limits := r.Worker.constraints(ShapeTypeRectangle)
+	x1, y1, x2, y2 := r.bounds()
+	return limits.fits(float64(x2-x1+1), float64(y2-y1+1))
 }
 
 func (r *Rectangle) Rasterize() []Scanline {
@@ -88,9 +107,9 @@ func NewRandomRotatedRectangle(worker *Worker) *RotatedRectangle {
 	rnd := worker.Rnd
 	x := rnd.Intn(worker.W)
 	y := rnd.Intn(worker.H)
-	sx := rnd.Intn(32) + 1
-	sy := rnd.Intn(32) + 1
-	a := rnd.Intn(360)
+	limits := worker.constraints(ShapeTypeRotatedRectangle)
+	sx, sy := limits.fitSides(worker.spawnInt(rnd.Intn(32)+1), worker.spawnInt(rnd.Intn(32)+1))
+	a := int(math.Round(limits.snapAngle(float64(rnd.Intn(360)))))
 	r := &RotatedRectangle{worker, x, y, sx, sy, a}
 	r.Mutate()
 	return r
@@ -112,6 +131,10 @@ func (r *RotatedRectangle) SVG(attrs string) string {
 		r.X, r.Y, r.Angle, r.Sx, r.Sy, attrs)
 }
 
+func (r *RotatedRectangle) svgTransform() (x, y, angle, sx, sy float64) {
+	return float64(r.X), float64(r.Y), float64(r.Angle), float64(r.Sx), float64(r.Sy)
+}
+
 func (r *RotatedRectangle) Copy() Shape {
 	a := *r
 	return &a
@@ -121,15 +144,21 @@ func (r *RotatedRectangle) Mutate() {
 	w := r.Worker.W
 	h := r.Worker.H
 	rnd := r.Worker.Rnd
+	limits := r.Worker.constraints(ShapeTypeRotatedRectangle)
 	switch rnd.Intn(3) {
 	case 0:
-		r.X = clampInt(r.X+int(rnd.NormFloat64()*16), 0, w-1)
-		r.Y = clampInt(r.Y+int(rnd.NormFloat64()*16), 0, h-1)
+		r.X = clampInt(r.X+int(rnd.NormFloat64()*limits.Step), 0, w-1)
+		r.Y = clampInt(r.Y+int(rnd.NormFloat64()*limits.Step), 0, h-1)
 	case 1:
-		r.Sx = clampInt(r.Sx+int(rnd.NormFloat64()*16), 1, w-1)
-		r.Sy = clampInt(r.Sy+int(rnd.NormFloat64()*16), 1, h-1)
+		r.Sx = clampInt(r.Sx+int(rnd.NormFloat64()*limits.Step), 1, w-1)
+		r.Sy = clampInt(r.Sy+int(rnd.NormFloat64()*limits.Step), 1, h-1)
+		r.Sx, r.Sy = limits.fitSides(r.Sx, r.Sy)
 	case 2:
-		r.Angle = r.Angle + int(rnd.NormFloat64()*32)
+		if len(limits.Angles) > 0 {
+			r.Angle = int(math.Round(limits.mutateAngle(rnd, float64(r.Angle))))
+		} else {
+			r.Angle = r.Angle + int(rnd.NormFloat64()*32)
+		}
 	}
 	// for !r.Valid() {
 	// 	r.Sx = clampInt(r.Sx+int(rnd.NormFloat64()*16), 0, w-1)
@@ -137,13 +166,10 @@ func (r *RotatedRectangle) Mutate() {
 	// }
 }
 
+// Valid checks the rectangle against its size and aspect constraints,
+// which whole pixel sides may not meet exactly.
 func (r *RotatedRectangle) Valid() bool {
-	a, b := r.Sx, r.Sy
-	if a < b {
-		a, b = b, a
-	}
-	aspect := float64(a) / float64(b)
-	return aspect <= 5
+	return r.Worker.constraints(ShapeTypeRotatedRectangle).fits(float64(r.Sx), float64(r.Sy))
 }
 
 func (r *RotatedRectangle) Rasterize() []Scanline {
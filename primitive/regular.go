@@ -0,0 +1,216 @@
+package primitive
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/raster"
+)
+
+// unitVertices returns n points around the unit circle, the first pointing
+// up, whose distances from the center cycle through radii.
+func unitVertices(n int, radii ...float64) (u, v []float64) {
+	u = make([]float64, n)
+	v = make([]float64, n)
+	for i := 0; i < n; i++ {
+		a := 2*math.Pi*float64(i)/float64(n) - math.Pi/2
+		r := radii[i%len(radii)]
+		u[i] = math.Cos(a) * r
+		v[i] = math.Sin(a) * r
+	}
+	return u, v
+}
+
+// placeVertices rotates unit vertices by angle degrees, scales them by r
+// and moves them to x, y.
+func placeVertices(u, v []float64, x, y, r, angle float64) (px, py []float64) {
+	px = make([]float64, len(u))
+	py = make([]float64, len(v))
+	theta := radians(angle)
+	for i := range u {
+		rx, ry := rotate(u[i]*r, v[i]*r, theta)
+		px[i] = x + rx
+		py[i] = y + ry
+	}
+	return px, py
+}
+
+func drawVertices(dc *gg.Context, x, y []float64) {
+	dc.NewSubPath()
+	for i := range x {
+		dc.LineTo(x[i], y[i])
+	}
+	dc.ClosePath()
+	dc.Fill()
+}
+
+// svgVertices writes unit vertices as a polygon scaled and placed by the
+// enclosing group, so that ReadSVG can recover the shape's parameters.
+func svgVertices(attrs string, u, v []float64, x, y, r, angle float64) string {
+	points := make([]string, len(u))
+	for i := range u {
+		points[i] = fmt.Sprintf("%f,%f", u[i], v[i])
+	}
+	return fmt.Sprintf(
+		"<g transform=\"translate(%f %f) rotate(%f) scale(%f %f)\"><polygon %s points=\"%s\" /></g>",
+		x, y, angle, r, r, attrs, strings.Join(points, " "))
+}
+
+func rasterizeVertices(worker *Worker, x, y []float64) []Scanline {
+	var path raster.Path
+	path.Start(fixp(x[0], y[0]))
+	for i := 1; i <= len(x); i++ {
+		path.Add1(fixp(x[i%len(x)], y[i%len(y)]))
+	}
+	return fillPath(worker, path)
+}
+
+// mutateVertexShape moves, resizes or rotates a shape placed by
+// placeVertices within limits, picking one of n changes; changes from 3 on
+// are left to the caller and reported by the return value.
+func mutateVertexShape(worker *Worker, limits Constraints, x, y, r, angle *float64, n int) int {
+	m := limits.Margin
+	w := worker.W
+	h := worker.H
+	rnd := worker.Rnd
+	k := rnd.Intn(n)
+	switch k {
+	case 0:
+		*x = clamp(*x+rnd.NormFloat64()*limits.Step, -m, float64(w-1)+m)
+		*y = clamp(*y+rnd.NormFloat64()*limits.Step, -m, float64(h-1)+m)
+	case 1:
+		*r = clamp(*r+rnd.NormFloat64()*limits.Step/2, 2, float64(maxInt(w, h)))
+		d, _ := limits.fit(*r*2, 0)
+		*r = d / 2
+	case 2:
+		*angle = limits.mutateAngle(rnd, *angle)
+	}
+	return k
+}
+
+// randomVertexShape returns a random radius and angle for a new shape of
+// type t placed by placeVertices.
+func randomVertexShape(worker *Worker, t ShapeType) (r, angle float64) {
+	rnd := worker.Rnd
+	limits := worker.constraints(t)
+	d, _ := limits.fit((rnd.Float64()*16+4)*worker.spawnScale()*2, 0)
+	return d / 2, limits.snapAngle(rnd.Float64() * 360)
+}
+
+// RegularPolygon has Sides equal sides and is centered on X, Y with its
+// vertices Radius pixels away, rotated by Angle degrees from having a
+// vertex at the top.
+type RegularPolygon struct {
+	Worker *Worker
+	X, Y   float64
+	Radius float64
+	Angle  float64
+	Sides  int
+}
+
+func NewRandomRegularPolygon(worker *Worker, sides int) *RegularPolygon {
+	rnd := worker.Rnd
+	x := rnd.Float64() * float64(worker.W)
+	y := rnd.Float64() * float64(worker.H)
+	r, angle := randomVertexShape(worker, ShapeTypeRegularPolygon)
+	p := &RegularPolygon{worker, x, y, r, angle, sides}
+	p.Mutate()
+	return p
+}
+
+func (p *RegularPolygon) vertices() (x, y []float64) {
+	u, v := unitVertices(p.Sides, 1)
+	return placeVertices(u, v, p.X, p.Y, p.Radius, p.Angle)
+}
+
+func (p *RegularPolygon) Draw(dc *gg.Context, scale float64) {
+	x, y := p.vertices()
+	drawVertices(dc, x, y)
+}
+
+func (p *RegularPolygon) SVG(attrs string) string {
+	u, v := unitVertices(p.Sides, 1)
+	return svgVertices(attrs, u, v, p.X, p.Y, p.Radius, p.Angle)
+}
+
+func (p *RegularPolygon) svgTransform() (x, y, angle, sx, sy float64) {
+	return p.X, p.Y, p.Angle, p.Radius, p.Radius
+}
+
+func (p *RegularPolygon) Copy() Shape {
+	a := *p
+	return &a
+}
+
+func (p *RegularPolygon) Mutate() {
+	mutateVertexShape(p.Worker, p.Worker.constraints(ShapeTypeRegularPolygon), &p.X, &p.Y, &p.Radius, &p.Angle, 3)
+}
+
+func (p *RegularPolygon) Rasterize() []Scanline {
+	x, y := p.vertices()
+	return rasterizeVertices(p.Worker, x, y)
+}
+
+// Star has Points outer vertices Radius pixels from X, Y, alternating with
+// inner vertices at Inner times that distance. Angle rotates it in degrees
+// from having a point at the top.
+type Star struct {
+	Worker *Worker
+	X, Y   float64
+	Radius float64
+	Angle  float64
+	Points int
+	Inner  float64
+}
+
+func NewRandomStar(worker *Worker, points int) *Star {
+	rnd := worker.Rnd
+	x := rnd.Float64() * float64(worker.W)
+	y := rnd.Float64() * float64(worker.H)
+	r, angle := randomVertexShape(worker, ShapeTypeStar)
+	inner := rnd.Float64()*0.5 + 0.25
+	s := &Star{worker, x, y, r, angle, points, inner}
+	s.Mutate()
+	return s
+}
+
+func (s *Star) unitVertices() (u, v []float64) {
+	return unitVertices(s.Points*2, 1, s.Inner)
+}
+
+func (s *Star) vertices() (x, y []float64) {
+	u, v := s.unitVertices()
+	return placeVertices(u, v, s.X, s.Y, s.Radius, s.Angle)
+}
+
+func (s *Star) Draw(dc *gg.Context, scale float64) {
+	x, y := s.vertices()
+	drawVertices(dc, x, y)
+}
+
+func (s *Star) SVG(attrs string) string {
+	u, v := s.unitVertices()
+	return svgVertices(attrs, u, v, s.X, s.Y, s.Radius, s.Angle)
+}
+
+func (s *Star) svgTransform() (x, y, angle, sx, sy float64) {
+	return s.X, s.Y, s.Angle, s.Radius, s.Radius
+}
+
+func (s *Star) Copy() Shape {
+	a := *s
+	return &a
+}
+
+func (s *Star) Mutate() {
+	if mutateVertexShape(s.Worker, s.Worker.constraints(ShapeTypeStar), &s.X, &s.Y, &s.Radius, &s.Angle, 4) == 3 {
+		s.Inner = clamp(s.Inner+s.Worker.Rnd.NormFloat64()*0.1, 0.1, 0.9)
+	}
+}
+
+func (s *Star) Rasterize() []Scanline {
+	x, y := s.vertices()
+	return rasterizeVertices(s.Worker, x, y)
+}
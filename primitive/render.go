@@ -0,0 +1,190 @@
+package primitive
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+
+	"github.com/golang/freetype/raster"
+)
+
+type RenderOptions struct {
+	// Supersample renders at this many times the requested size and box
+	// filters the result down, for smoother edges. Values below 2 disable it.
+	Supersample int
+	// Native draws the output with the same scanline rasterizer and
+	// compositing used for scoring instead of gg, so the rendered image
+	// matches what the optimizer saw. Only the built-in shape types can be
+	// rendered natively.
+	Native bool
+}
+
+// Render draws the model's shapes at an arbitrary output size without
+// re-running the optimizer. Like NewModel, size is the length of the longer
+// side of the output image. It fails if opts.Native is set and a shape is
+// not one of the built-in types.
+func (model *Model) Render(size int, opts RenderOptions) (*image.RGBA, error) {
+	ss := max(opts.Supersample, 1)
+	w := model.Current.Bounds().Size().X
+	h := model.Current.Bounds().Size().Y
+	sw, sh, scale := outputSize(w, h, size)
+	var im *image.RGBA
+	if opts.Native {
+		var err error
+		if im, err = model.renderNative(sw*ss, sh*ss, scale*float64(ss)); err != nil {
+			return nil, err
+		}
+	} else {
+		dc := newModelContext(sw*ss, sh*ss, scale*float64(ss), model.Background.NRGBA())
+		for i, shape := range model.Shapes {
+			drawShape(dc, shape, model.Colors[i], model.Gradients[i], model.blend(), scale*float64(ss))
+		}
+		im = imageToRGBA(dc.Image())
+	}
+	if ss > 1 {
+		im = downsample(im, ss)
+	}
+	return im, nil
+}
+
+func (model *Model) renderNative(sw, sh int, scale float64) (*image.RGBA, error) {
+	im := uniformRGBA(image.Rect(0, 0, sw, sh), model.Background.NRGBA())
+	worker := newRenderWorker(sw, sh)
+	for i, shape := range model.Shapes {
+		scaled, err := scaleShape(shape, worker, scale)
+		if err != nil {
+			return nil, err
+		}
+		lines := cropScanlines(scaled.Rasterize(), sw, sh)
+		g := model.Gradients[i]
+		if g != nil {
+			g = g.scaled(scale)
+		}
+		drawPaint(im, model.Colors[i], g, model.blend(), lines)
+	}
+	return im, nil
+}
+
+// newRenderWorker returns a worker that can only rasterize shapes. It skips
+// the buffers needed for scoring, which would be large at output sizes.
+func newRenderWorker(w, h int) *Worker {
+	return &Worker{
+		W:          w,
+		H:          h,
+		Target:     nil,
+		Current:    nil,
+		Buffer:     nil,
+		Heatmap:    nil,
+		Rasterizer: raster.NewRasterizer(w, h),
+		Lines:      make([]Scanline, 0, h*2),
+		Rnd:        rand.New(rand.NewSource(0)),
+		Options:    DefaultShapeOptions(),
+		StepScale:  1,
+		Score:      0,
+		Total:      0,
+		Counter:    0,
+		Tasks:      0,
+		Steals:     0,
+		Busy:       0,
+	}
+}
+
+// scaleShape returns a copy of shape magnified by s and bound to worker.
+// Integer pixel coordinates are mapped so that a pixel covers the same
+// block of output pixels it would after upscaling. Shapes that are not
+// one of the built-in types cannot be scaled.
+func scaleShape(shape Shape, worker *Worker, s float64) (Shape, error) {
+	si := func(x int) int {
+		return int(math.Round(float64(x) * s))
+	}
+	switch t := shape.(type) {
+	case *Triangle:
+		return &Triangle{worker, si(t.X1), si(t.Y1), si(t.X2), si(t.Y2), si(t.X3), si(t.Y3), t.Outline * s}, nil
+	case *Rectangle:
+		x1, y1, x2, y2 := t.bounds()
+		return &Rectangle{worker, si(x1), si(y1), si(x2+1) - 1, si(y2+1) - 1}, nil
+	case *Ellipse:
+		return &Ellipse{worker, si(t.X), si(t.Y), si(t.Rx), si(t.Ry), t.Circle, t.Outline * s}, nil
+	case *RotatedRectangle:
+		return &RotatedRectangle{worker, si(t.X), si(t.Y), si(t.Sx), si(t.Sy), t.Angle}, nil
+	case *Quadratic:
+		return &Quadratic{worker, t.X1 * s, t.Y1 * s, t.X2 * s, t.Y2 * s, t.X3 * s, t.Y3 * s, t.Width * s}, nil
+	case *RotatedEllipse:
+		return &RotatedEllipse{worker, t.X * s, t.Y * s, t.Rx * s, t.Ry * s, t.Angle, t.Outline * s}, nil
+	case *Polygon:
+		p, _ := t.Copy().(*Polygon)
+		p.Worker = worker
+		for i := range p.X {
+			p.X[i] *= s
+			p.Y[i] *= s
+		}
+		p.Outline *= s
+		return p, nil
+	case *Cubic:
+		return &Cubic{worker, t.X1 * s, t.Y1 * s, t.X2 * s, t.Y2 * s, t.X3 * s, t.Y3 * s, t.X4 * s, t.Y4 * s, t.Width * s}, nil
+	case *Blob:
+		b, _ := t.Copy().(*Blob)
+		b.Worker = worker
+		for i := range b.X {
+			b.X[i] *= s
+			b.Y[i] *= s
+		}
+		return b, nil
+	case *Line:
+		return &Line{worker, t.X1 * s, t.Y1 * s, t.X2 * s, t.Y2 * s, t.Width * s, t.Cap}, nil
+	case *Polyline:
+		p, _ := t.Copy().(*Polyline)
+		p.Worker = worker
+		for i := range p.X {
+			p.X[i] *= s
+			p.Y[i] *= s
+		}
+		p.Width *= s
+		return p, nil
+	case *Glyph:
+		g, _ := t.Copy().(*Glyph)
+		g.Worker = worker
+		g.X *= s
+		g.Y *= s
+		g.Size *= s
+		return g, nil
+	case *Stamp:
+		return &Stamp{worker, t.Sprite, t.X * s, t.Y * s, t.Size * s, t.Angle}, nil
+	case *RegularPolygon:
+		return &RegularPolygon{worker, t.X * s, t.Y * s, t.Radius * s, t.Angle, t.Sides}, nil
+	case *Star:
+		return &Star{worker, t.X * s, t.Y * s, t.Radius * s, t.Angle, t.Points, t.Inner}, nil
+	default:
+		return nil, fmt.Errorf("cannot scale shape %T", shape)
+	}
+}
+
+// downsample shrinks im by an integer factor, averaging each f x f block.
+func downsample(im *image.RGBA, f int) *image.RGBA {
+	size := im.Bounds().Size()
+	w, h := size.X/f, size.Y/f
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	n := uint32(f * f)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var r, g, b, a uint32
+			for dy := 0; dy < f; dy++ {
+				i := im.PixOffset(x*f, y*f+dy)
+				for dx := 0; dx < f; dx++ {
+					r += uint32(im.Pix[i+0])
+					g += uint32(im.Pix[i+1])
+					b += uint32(im.Pix[i+2])
+					a += uint32(im.Pix[i+3])
+					i += 4
+				}
+			}
+			j := dst.PixOffset(x, y)
+			dst.Pix[j+0] = uint8(r / n)
+			dst.Pix[j+1] = uint8(g / n)
+			dst.Pix[j+2] = uint8(b / n)
+			dst.Pix[j+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
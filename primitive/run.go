@@ -0,0 +1,131 @@
+package primitive
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Stage adds Count shapes of one type with the given alpha and repeat count.
+// An Alpha of zero solves the alpha of each shape. If AlphaEnd is not zero,
+// the alpha moves linearly from Alpha for the first step to AlphaEnd for
+// the last. If Tiles is above 1, each step searches a Tiles x Tiles grid
+// of the canvas at once and may add a shape for each tile; see StepTiles.
+type Stage struct {
+	Count     int
+	ShapeType ShapeType
+	Alpha     int
+	AlphaEnd  int
+	Repeat    int
+	Tiles     int
+}
+
+// alpha returns the alpha of the stage's ith step.
+func (stage Stage) alpha(i int) int {
+	if stage.Alpha == 0 || stage.AlphaEnd == 0 || stage.Count < 2 {
+		return stage.Alpha
+	}
+	t := float64(i) / float64(stage.Count-1)
+	return int(math.Round(float64(stage.Alpha) + float64(stage.AlphaEnd-stage.Alpha)*t))
+}
+
+// Progress is reported by Run after every step.
+type Progress struct {
+	// Counters holds the evaluations made by each worker during the step.
+	Counters []int
+	// Workers holds the statistics of each worker for the step.
+	Workers []WorkerStats
+	// Stage is the index of the stage the step belongs to.
+	Stage int
+	// Frame counts the steps taken so far, starting at 1.
+	Frame int
+	// Frames is the total number of steps over all stages.
+	Frames int
+	// Score is the model score after the step.
+	Score float64
+	// Evaluations is the number of shapes scored during the step.
+	Evaluations int
+	// Shapes is the number of shapes the step added.
+	Shapes int
+	// ShapeType and Alpha describe the last shape added.
+	ShapeType ShapeType
+	Alpha     int
+	// Duration is the wall time of the step.
+	Duration time.Duration
+	// Elapsed is the wall time since Run started.
+	Elapsed time.Duration
+}
+
+func (p Progress) Last() bool {
+	return p.Frame == p.Frames
+}
+
+// NPS returns the evaluations per second of the step, or 0 if the step
+// took no measurable time.
+func (p Progress) NPS() float64 {
+	if p.Duration <= 0 {
+		return 0
+	}
+	return float64(p.Evaluations) / p.Duration.Seconds()
+}
+
+// Run steps the model through every stage in order, calling fn after each
+// step. It stops early if ctx is canceled or fn returns an error. The
+// model is closed when Run returns.
+func (model *Model) Run(ctx context.Context, stages []Stage, fn func(Progress) error) error {
+	defer model.Close()
+	frames := 0
+	for _, stage := range stages {
+		frames += stage.Count
+	}
+	start := time.Now()
+	frame := 0
+	for i, stage := range stages {
+		for j := range stage.Count {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			frame++
+			t := time.Now()
+			before := len(model.Shapes)
+			var n int
+			var err error
+			if stage.Tiles > 1 {
+				n, err = model.StepTiles(ctx, stage.ShapeType, stage.alpha(j), stage.Tiles)
+			} else {
+				n = model.Step(ctx, stage.ShapeType, stage.alpha(j), stage.Repeat)
+			}
+			if err != nil {
+				return err
+			}
+			last := len(model.Shapes) - 1
+			counters := make([]int, len(model.Workers))
+			workers := make([]WorkerStats, len(model.Workers))
+			for k, worker := range model.Workers {
+				counters[k] = worker.Counter
+				workers[k] = worker.Stats()
+			}
+			progress := Progress{
+				Stage:       i,
+				Frame:       frame,
+				Frames:      frames,
+				Score:       model.Score,
+				Evaluations: n,
+				Counters:    counters,
+				Workers:     workers,
+				Shapes:      last + 1 - before,
+				ShapeType:   shapeTypeOf(model.Shapes[last]),
+				Alpha:       model.Colors[last].A,
+				Duration:    time.Since(t),
+				Elapsed:     time.Since(start),
+			}
+			if fn == nil {
+				continue
+			}
+			if err = fn(progress); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,6 +1,10 @@
 package primitive
 
-import "github.com/fogleman/gg"
+import (
+	"fmt"
+
+	"github.com/fogleman/gg"
+)
 
 type Shape interface {
 	Rasterize() []Scanline
@@ -22,4 +26,52 @@ const (
 	ShapeTypeQuadratic
 	ShapeTypeRotatedEllipse
 	ShapeTypePolygon
+	ShapeTypeCubic
+	ShapeTypeBlob
+	ShapeTypeLine
+	ShapeTypePolyline
+	ShapeTypeGlyph
+	ShapeTypeStamp
+	ShapeTypeRegularPolygon
+	ShapeTypeStar
 )
+
+var shapeTypeNames = map[ShapeType]string{
+	ShapeTypeAny:              "any",
+	ShapeTypeTriangle:         "triangle",
+	ShapeTypeRectangle:        "rectangle",
+	ShapeTypeEllipse:          "ellipse",
+	ShapeTypeCircle:           "circle",
+	ShapeTypeRotatedRectangle: "rotatedrectangle",
+	ShapeTypeQuadratic:        "quadratic",
+	ShapeTypeRotatedEllipse:   "rotatedellipse",
+	ShapeTypePolygon:          "polygon",
+	ShapeTypeCubic:            "cubic",
+	ShapeTypeBlob:             "blob",
+	ShapeTypeLine:             "line",
+	ShapeTypePolyline:         "polyline",
+	ShapeTypeGlyph:            "glyph",
+	ShapeTypeStamp:            "stamp",
+	ShapeTypeRegularPolygon:   "regularpolygon",
+	ShapeTypeStar:             "star",
+}
+
+func (t ShapeType) String() string {
+	if name, ok := shapeTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("ShapeType(%d)", int(t))
+}
+
+func (t ShapeType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func ParseShapeType(name string) (ShapeType, error) {
+	for t, n := range shapeTypeNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return ShapeTypeAny, fmt.Errorf("unknown shape type: %q", name)
+}
@@ -0,0 +1,422 @@
+package primitive
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ShapeFile is the serialized form of a model: the size of the image the
+// shapes were fitted to, its background and every shape with its color.
+type ShapeFile struct {
+	Shapes     []ShapeRecord `json:"shapes"`
+	Background Color         `json:"background"`
+	Blend      BlendMode     `json:"blend,omitempty"`
+	Width      int           `json:"width"`
+	Height     int           `json:"height"`
+}
+
+// ShapeRecord is one shape of a shape file. A shape with a gradient fill
+// has the gradient's start color as its Color.
+type ShapeRecord struct {
+	Type     string    `json:"type"`
+	Gradient *Gradient `json:"gradient,omitempty"`
+	Params   []float64 `json:"params"`
+	Color    Color     `json:"color"`
+	Score    float64   `json:"score,omitempty"`
+}
+
+func (model *Model) ShapeFile() *ShapeFile {
+	size := model.Current.Bounds().Size()
+	file := &ShapeFile{
+		Width:      size.X,
+		Height:     size.Y,
+		Background: *model.Background,
+		Shapes:     make([]ShapeRecord, len(model.Shapes)),
+		Blend:      model.blend(),
+	}
+	for i, shape := range model.Shapes {
+		file.Shapes[i] = NewShapeRecord(shape, model.Colors[i], model.Gradients[i], model.Scores[i])
+	}
+	return file
+}
+
+func NewShapeRecord(shape Shape, color Color, gradient *Gradient, score float64) ShapeRecord {
+	t, params := encodeShape(shape)
+	return ShapeRecord{
+		Type:     t.String(),
+		Params:   params,
+		Color:    color,
+		Gradient: gradient,
+		Score:    score,
+	}
+}
+
+func (model *Model) JSON() ([]byte, error) {
+	return json.MarshalIndent(model.ShapeFile(), "", "  ")
+}
+
+func ReadShapeFile(r io.Reader) (*ShapeFile, error) {
+	var file ShapeFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+func LoadShapeFile(path string) (*ShapeFile, error) {
+	if path == "-" {
+		return ReadShapeFile(os.Stdin)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadShapeFile(file)
+}
+
+// Model rebuilds a model from the shape file by replaying its shapes onto
+// the background. The model has no target image, so it can be rendered and
+// exported but not stepped. opts supplies the font and sprite for glyph
+// and stamp shapes; the blend mode is the file's.
+func (f *ShapeFile) Model(size int, opts ShapeOptions) (*Model, error) {
+	if f.Width < 1 || f.Height < 1 {
+		return nil, fmt.Errorf("invalid shape file size: %dx%d", f.Width, f.Height)
+	}
+	bg := f.Background
+	bounds := image.Rect(0, 0, f.Width, f.Height)
+	current := uniformRGBA(bounds, bg.NRGBA())
+	sw, sh, scale := outputSize(f.Width, f.Height, size)
+	worker := NewWorker(current)
+	worker.Options = opts
+	worker.Options.Blend = f.Blend
+	model := &Model{
+		Sw:         sw,
+		Sh:         sh,
+		Scale:      scale,
+		Background: &bg,
+		Target:     nil,
+		Current:    current,
+		Score:      0,
+		Total:      0,
+		rows:       nil,
+		Context:    newModelContext(sw, sh, scale, bg.NRGBA()),
+		Shapes:     nil,
+		Colors:     nil,
+		Gradients:  nil,
+		Scores:     nil,
+		Workers:    []*Worker{worker},
+		Limiter:    nil,
+		OnAdd:      nil,
+		pool:       nil,
+		rnd:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		tileGrid:   0,
+		tileCells:  nil,
+	}
+	for i, record := range f.Shapes {
+		t, err := ParseShapeType(record.Type)
+		if err != nil {
+			return nil, fmt.Errorf("shape %d: %w", i, err)
+		}
+		shape, err := decodeShape(worker, t, record.Params)
+		if err != nil {
+			return nil, fmt.Errorf("shape %d: %w", i, err)
+		}
+		c, g := record.Color, record.Gradient
+		drawPaint(model.Current, c, g, f.Blend, shape.Rasterize())
+		model.Score = record.Score
+		model.Shapes = append(model.Shapes, shape)
+		model.Colors = append(model.Colors, c)
+		model.Gradients = append(model.Gradients, g)
+		model.Scores = append(model.Scores, record.Score)
+		drawShape(model.Context, shape, c, g, f.Blend, model.Scale)
+	}
+	return model, nil
+}
+
+func shapeTypeOf(shape Shape) ShapeType {
+	switch s := shape.(type) {
+	case *Triangle:
+		return ShapeTypeTriangle
+	case *Rectangle:
+		return ShapeTypeRectangle
+	case *Ellipse:
+		if s.Circle {
+			return ShapeTypeCircle
+		}
+		return ShapeTypeEllipse
+	case *RotatedRectangle:
+		return ShapeTypeRotatedRectangle
+	case *Quadratic:
+		return ShapeTypeQuadratic
+	case *RotatedEllipse:
+		return ShapeTypeRotatedEllipse
+	case *Polygon:
+		return ShapeTypePolygon
+	case *Cubic:
+		return ShapeTypeCubic
+	case *Blob:
+		return ShapeTypeBlob
+	case *Line:
+		return ShapeTypeLine
+	case *Polyline:
+		return ShapeTypePolyline
+	case *Glyph:
+		return ShapeTypeGlyph
+	case *Stamp:
+		return ShapeTypeStamp
+	case *RegularPolygon:
+		return ShapeTypeRegularPolygon
+	case *Star:
+		return ShapeTypeStar
+	default:
+		return ShapeTypeAny
+	}
+}
+
+func encodeShape(shape Shape) (ShapeType, []float64) {
+	t := shapeTypeOf(shape)
+	switch s := shape.(type) {
+	case *Triangle:
+		return t, withOutline(ints(s.X1, s.Y1, s.X2, s.Y2, s.X3, s.Y3), s.Outline)
+	case *Rectangle:
+		return t, ints(s.X1, s.Y1, s.X2, s.Y2)
+	case *Ellipse:
+		return t, withOutline(ints(s.X, s.Y, s.Rx, s.Ry), s.Outline)
+	case *RotatedRectangle:
+		return t, ints(s.X, s.Y, s.Sx, s.Sy, s.Angle)
+	case *Quadratic:
+		return t, []float64{s.X1, s.Y1, s.X2, s.Y2, s.X3, s.Y3, s.Width}
+	case *RotatedEllipse:
+		return t, withOutline([]float64{s.X, s.Y, s.Rx, s.Ry, s.Angle}, s.Outline)
+	case *Polygon:
+		return t, withOutline(joinPoints(s.X, s.Y), s.Outline)
+	case *Cubic:
+		return t, []float64{s.X1, s.Y1, s.X2, s.Y2, s.X3, s.Y3, s.X4, s.Y4, s.Width}
+	case *Blob:
+		return t, joinPoints(s.X, s.Y)
+	case *Line:
+		return t, []float64{s.X1, s.Y1, s.X2, s.Y2, s.Width, float64(s.Cap)}
+	case *Polyline:
+		return t, append(joinPoints(s.X, s.Y), s.Width, float64(s.Cap), float64(s.Join))
+	case *Glyph:
+		return t, []float64{s.X, s.Y, s.Size, s.Angle, float64(s.Rune)}
+	case *Stamp:
+		return t, []float64{s.X, s.Y, s.Size, s.Angle}
+	case *RegularPolygon:
+		return t, []float64{s.X, s.Y, s.Radius, s.Angle, float64(s.Sides)}
+	case *Star:
+		return t, []float64{s.X, s.Y, s.Radius, s.Angle, float64(s.Points), s.Inner}
+	default:
+		return t, nil
+	}
+}
+
+func decodeShape(worker *Worker, t ShapeType, p []float64) (Shape, error) {
+	n := len(p)
+	expect := func(want ...int) error {
+		if slices.Contains(want, n) {
+			return nil
+		}
+		counts := make([]string, len(want))
+		for k, w := range want {
+			counts[k] = strconv.Itoa(w)
+		}
+		return fmt.Errorf("%s: expected %s params, got %d", t, strings.Join(counts, " or "), n)
+	}
+	// outline reads the optional outline width after the first k params
+	outline := func(k int) (float64, error) {
+		if n == k {
+			return 0, nil
+		}
+		if p[k] <= 0 {
+			return 0, fmt.Errorf("%s: outline width must be positive, got %v", t, p[k])
+		}
+		return p[k], nil
+	}
+	i := func(k int) int {
+		return int(math.Round(p[k]))
+	}
+	enum := func(k int, names []string) (int, error) {
+		if v := i(k); v >= 0 && v < len(names) {
+			return v, nil
+		}
+		return 0, fmt.Errorf("%s: param %d out of range: %v", t, k, p[k])
+	}
+	switch t {
+	default:
+		return nil, fmt.Errorf("cannot decode shape type %s", t)
+	case ShapeTypeTriangle:
+		if err := expect(6, 7); err != nil {
+			return nil, err
+		}
+		w, err := outline(6)
+		if err != nil {
+			return nil, err
+		}
+		return &Triangle{worker, i(0), i(1), i(2), i(3), i(4), i(5), w}, nil
+	case ShapeTypeRectangle:
+		if err := expect(4); err != nil {
+			return nil, err
+		}
+		return &Rectangle{worker, i(0), i(1), i(2), i(3)}, nil
+	case ShapeTypeEllipse, ShapeTypeCircle:
+		if err := expect(4, 5); err != nil {
+			return nil, err
+		}
+		w, err := outline(4)
+		if err != nil {
+			return nil, err
+		}
+		return &Ellipse{worker, i(0), i(1), i(2), i(3), t == ShapeTypeCircle, w}, nil
+	case ShapeTypeRotatedRectangle:
+		if err := expect(5); err != nil {
+			return nil, err
+		}
+		return &RotatedRectangle{worker, i(0), i(1), i(2), i(3), i(4)}, nil
+	case ShapeTypeQuadratic:
+		if err := expect(7); err != nil {
+			return nil, err
+		}
+		return &Quadratic{worker, p[0], p[1], p[2], p[3], p[4], p[5], p[6]}, nil
+	case ShapeTypeRotatedEllipse:
+		if err := expect(5, 6); err != nil {
+			return nil, err
+		}
+		w, err := outline(5)
+		if err != nil {
+			return nil, err
+		}
+		return &RotatedEllipse{worker, p[0], p[1], p[2], p[3], p[4], w}, nil
+	case ShapeTypePolygon:
+		// an odd param is the outline width
+		if n < 6 {
+			return nil, fmt.Errorf("%s: expected at least 6 params, got %d", t, n)
+		}
+		w, err := outline(n - n%2)
+		if err != nil {
+			return nil, err
+		}
+		x, y := splitPoints(p[:n-n%2])
+		return &Polygon{Worker: worker, X: x, Y: y, Order: len(x), Convex: false, Outline: w}, nil
+	case ShapeTypeCubic:
+		if err := expect(9); err != nil {
+			return nil, err
+		}
+		return &Cubic{worker, p[0], p[1], p[2], p[3], p[4], p[5], p[6], p[7], p[8]}, nil
+	case ShapeTypeBlob:
+		if n < 6 || n%2 != 0 {
+			return nil, fmt.Errorf("%s: expected an even number of at least 6 params, got %d", t, n)
+		}
+		x, y := splitPoints(p)
+		return &Blob{Worker: worker, X: x, Y: y, Order: len(x)}, nil
+	case ShapeTypeLine:
+		if err := expect(6); err != nil {
+			return nil, err
+		}
+		c, err := enum(5, lineCapNames)
+		if err != nil {
+			return nil, err
+		}
+		return &Line{worker, p[0], p[1], p[2], p[3], p[4], LineCap(c)}, nil
+	case ShapeTypePolyline:
+		if n < 7 || n%2 != 1 {
+			return nil, fmt.Errorf("%s: expected an odd number of at least 7 params, got %d", t, n)
+		}
+		c, err := enum(n-2, lineCapNames)
+		if err != nil {
+			return nil, err
+		}
+		j, err := enum(n-1, lineJoinNames)
+		if err != nil {
+			return nil, err
+		}
+		x, y := splitPoints(p[:n-3])
+		return &Polyline{
+			Worker: worker,
+			X:      x,
+			Y:      y,
+			Order:  len(x),
+			Width:  p[n-3],
+			Cap:    LineCap(c),
+			Join:   LineJoin(j),
+		}, nil
+	case ShapeTypeGlyph:
+		if err := expect(5); err != nil {
+			return nil, err
+		}
+		if worker.Options.Font == nil {
+			return nil, fmt.Errorf("%s: a font is required", t)
+		}
+		return NewGlyph(worker, worker.Options.Font, rune(i(4)), p[0], p[1], p[2], p[3])
+	case ShapeTypeStamp:
+		if err := expect(4); err != nil {
+			return nil, err
+		}
+		if worker.Options.Sprite == nil {
+			return nil, fmt.Errorf("%s: a sprite is required", t)
+		}
+		return &Stamp{worker, worker.Options.Sprite, p[0], p[1], p[2], p[3]}, nil
+	case ShapeTypeRegularPolygon:
+		if err := expect(5); err != nil {
+			return nil, err
+		}
+		if i(4) < 3 {
+			return nil, fmt.Errorf("%s: expected at least 3 sides, got %v", t, p[4])
+		}
+		return &RegularPolygon{worker, p[0], p[1], p[2], p[3], i(4)}, nil
+	case ShapeTypeStar:
+		if err := expect(6); err != nil {
+			return nil, err
+		}
+		if i(4) < 2 {
+			return nil, fmt.Errorf("%s: expected at least 2 points, got %v", t, p[4])
+		}
+		return &Star{worker, p[0], p[1], p[2], p[3], i(4), p[5]}, nil
+	}
+}
+
+// withOutline appends the outline width to the params of an outlined
+// shape; filled shapes have none.
+func withOutline(params []float64, outline float64) []float64 {
+	if outline > 0 {
+		params = append(params, outline)
+	}
+	return params
+}
+
+// joinPoints interleaves x and y into x1, y1, x2, y2, ...
+func joinPoints(x, y []float64) []float64 {
+	params := make([]float64, 0, len(x)*2)
+	for i := range x {
+		params = append(params, x[i], y[i])
+	}
+	return params
+}
+
+func splitPoints(p []float64) (x, y []float64) {
+	x = make([]float64, len(p)/2)
+	y = make([]float64, len(p)/2)
+	for i := range x {
+		x[i] = p[i*2]
+		y[i] = p[i*2+1]
+	}
+	return x, y
+}
+
+func ints(values ...int) []float64 {
+	result := make([]float64, len(values))
+	for i, v := range values {
+		result[i] = float64(v)
+	}
+	return result
+}
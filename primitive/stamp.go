@@ -0,0 +1,231 @@
+package primitive
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"sync"
+
+	"github.com/fogleman/gg"
+)
+
+// Sprite is a bitmap placed by stamp shapes, used as an alpha mask that is
+// filled with the shape's color.
+type Sprite struct {
+	Mask    *image.Alpha
+	dataURI string
+	once    sync.Once
+}
+
+// NewSprite makes a sprite from im. Its alpha channel is the mask; if im is
+// fully opaque, dark pixels are treated as opaque and light ones as clear,
+// so a black brush on a white background works as expected.
+func NewSprite(im image.Image) *Sprite {
+	b := im.Bounds()
+	mask := image.NewAlpha(image.Rect(0, 0, b.Dx(), b.Dy()))
+	opaque := true
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			_, _, _, a := im.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			mask.Pix[mask.PixOffset(x, y)] = uint8(a >> 8)
+			opaque = opaque && a == 0xffff
+		}
+	}
+	if opaque {
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				r, g, b2, _ := im.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				l := (299*r + 587*g + 114*b2) / 1000
+				mask.Pix[mask.PixOffset(x, y)] = uint8((0xffff - l) >> 8)
+			}
+		}
+	}
+	return &Sprite{Mask: mask, dataURI: "", once: sync.Once{}}
+}
+
+func LoadSprite(path string) (*Sprite, error) {
+	im, err := LoadImage(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewSprite(im), nil
+}
+
+func (s *Sprite) size() (w, h int) {
+	size := s.Mask.Bounds().Size()
+	return size.X, size.Y
+}
+
+// at samples the mask at u, v in sprite pixels, interpolating bilinearly
+// between pixel centers. Outside the sprite the mask is clear.
+func (s *Sprite) at(u, v float64) uint32 {
+	w, h := s.size()
+	fx, fy := u-0.5, v-0.5
+	x0, y0 := int(math.Floor(fx)), int(math.Floor(fy))
+	tx, ty := fx-float64(x0), fy-float64(y0)
+	px := func(x, y int) float64 {
+		if x < 0 || y < 0 || x >= w || y >= h {
+			return 0
+		}
+		return float64(s.Mask.Pix[s.Mask.PixOffset(x, y)])
+	}
+	a := (px(x0, y0)*(1-tx)+px(x0+1, y0)*tx)*(1-ty) + (px(x0, y0+1)*(1-tx)+px(x0+1, y0+1)*tx)*ty
+	return uint32(a+0.5) * 0x101
+}
+
+// DataURI returns the mask as a base64 PNG data URI. It is encoded once.
+func (s *Sprite) DataURI() string {
+	s.once.Do(func() {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, s.Mask); err != nil {
+			panic(err) // encoding to memory does not fail
+		}
+		s.dataURI = "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+	})
+	return s.dataURI
+}
+
+// Stamp places a sprite centered on X, Y, rotated by Angle degrees and
+// scaled so that its longer side is Size pixels.
+type Stamp struct {
+	Worker *Worker
+	Sprite *Sprite
+	X, Y   float64
+	Size   float64
+	Angle  float64
+}
+
+func NewRandomStamp(worker *Worker) *Stamp {
+	rnd := worker.Rnd
+	x := rnd.Float64() * float64(worker.W)
+	y := rnd.Float64() * float64(worker.H)
+	limits := worker.constraints(ShapeTypeStamp)
+	size, _ := limits.fit((rnd.Float64()*24+8)*worker.spawnScale(), 0)
+	angle := limits.snapAngle(rnd.Float64() * 360)
+	s := &Stamp{worker, worker.Options.Sprite, x, y, size, angle}
+	s.Mutate()
+	return s
+}
+
+// scanlines covers the sprite centered on cx, cy at k output pixels per
+// sprite pixel, sampling each pixel at its index plus offset. Runs of
+// pixels with equal coverage share a scanline.
+func (s *Stamp) scanlines(cx, cy, k, offset float64, w, h int, buf []Scanline) []Scanline {
+	sw, sh := s.Sprite.size()
+	r := k * math.Hypot(float64(sw), float64(sh)) / 2
+	x1 := clampInt(int(math.Floor(cx-r-offset)), 0, w-1)
+	x2 := clampInt(int(math.Ceil(cx+r-offset)), 0, w-1)
+	y1 := clampInt(int(math.Floor(cy-r-offset)), 0, h-1)
+	y2 := clampInt(int(math.Ceil(cy+r-offset)), 0, h-1)
+	sin, cos := math.Sincos(-radians(s.Angle))
+	for y := y1; y <= y2; y++ {
+		run := Scanline{y, 0, -1, 0}
+		for x := x1; x <= x2+1; x++ {
+			var a uint32
+			if x <= x2 {
+				dx, dy := float64(x)+offset-cx, float64(y)+offset-cy
+				u := (dx*cos-dy*sin)/k + float64(sw)/2
+				v := (dx*sin+dy*cos)/k + float64(sh)/2
+				a = s.Sprite.at(u, v)
+			}
+			if run.X2 >= run.X1 && a == run.Alpha {
+				run.X2 = x
+				continue
+			}
+			if run.X2 >= run.X1 && run.Alpha > 0 {
+				buf = append(buf, run)
+			}
+			run = Scanline{y, x, x, a}
+		}
+	}
+	return buf
+}
+
+// scale returns the output pixels per sprite pixel.
+func (s *Stamp) scale() float64 {
+	sw, sh := s.Sprite.size()
+	return s.Size / float64(maxInt(sw, sh))
+}
+
+// Draw fills through a mask of the stamp at the context's resolution, as gg
+// cannot fill with a transformed bitmap. The context may be scaled and
+// translated but not rotated.
+func (s *Stamp) Draw(dc *gg.Context, scale float64) {
+	w, h := dc.Width(), dc.Height()
+	x0, _ := dc.TransformPoint(0, 0)
+	x1, _ := dc.TransformPoint(1, 0)
+	cx, cy := dc.TransformPoint(s.X, s.Y)
+	mask := image.NewAlpha(image.Rect(0, 0, w, h))
+	for _, line := range s.scanlines(cx, cy, s.scale()*(x1-x0), 0.5, w, h, nil) {
+		i := mask.PixOffset(line.X1, line.Y)
+		for x := line.X1; x <= line.X2; x++ {
+			mask.Pix[i] = uint8(line.Alpha >> 8)
+			i++
+		}
+	}
+	dc.Push()
+	dc.Identity()
+	if err := dc.SetMask(mask); err != nil {
+		panic(err) // the mask is the size of the context
+	}
+	dc.DrawRectangle(0, 0, float64(w), float64(h))
+	dc.Fill()
+	dc.ResetClip() // Pop does not restore the mask
+	dc.Pop()
+}
+
+// SVG masks a rectangle the size of the sprite with the sprite image, which
+// svgDefs adds to the document once.
+func (s *Stamp) SVG(attrs string) string {
+	sw, sh := s.Sprite.size()
+	k := s.scale()
+	return fmt.Sprintf(
+		"<g transform=\"translate(%f %f) rotate(%f) scale(%f %f)\"><rect %s x=\"%f\" y=\"%f\" width=\"%d\" height=\"%d\" mask=\"url(#sprite)\" /></g>",
+		s.X, s.Y, s.Angle, k, k, attrs, -float64(sw)/2, -float64(sh)/2, sw, sh)
+}
+
+func (s *Stamp) svgTransform() (x, y, angle, sx, sy float64) {
+	k := s.scale()
+	return s.X, s.Y, s.Angle, k, k
+}
+
+func (s *Stamp) svgDefID() string {
+	return "sprite"
+}
+
+func (s *Stamp) svgDefs() string {
+	sw, sh := s.Sprite.size()
+	return fmt.Sprintf(
+		"<mask id=\"sprite\"><image x=\"%f\" y=\"%f\" width=\"%d\" height=\"%d\" href=\"%s\" /></mask>",
+		-float64(sw)/2, -float64(sh)/2, sw, sh, s.Sprite.DataURI())
+}
+
+func (s *Stamp) Copy() Shape {
+	a := *s
+	return &a
+}
+
+func (s *Stamp) Mutate() {
+	w := s.Worker.W
+	h := s.Worker.H
+	rnd := s.Worker.Rnd
+	limits := s.Worker.constraints(ShapeTypeStamp)
+	m := limits.Margin
+	switch rnd.Intn(3) {
+	case 0:
+		s.X = clamp(s.X+rnd.NormFloat64()*limits.Step, -m, float64(w-1)+m)
+		s.Y = clamp(s.Y+rnd.NormFloat64()*limits.Step, -m, float64(h-1)+m)
+	case 1:
+		s.Size = clamp(s.Size+rnd.NormFloat64()*limits.Step/2, 4, float64(maxInt(w, h)))
+		s.Size, _ = limits.fit(s.Size, s.Size)
+	case 2:
+		s.Angle = limits.mutateAngle(rnd, s.Angle)
+	}
+}
+
+func (s *Stamp) Rasterize() []Scanline {
+	return s.scanlines(s.X, s.Y, s.scale(), 0, s.Worker.W, s.Worker.H, s.Worker.Lines[:0])
+}
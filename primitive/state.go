@@ -1,20 +1,16 @@
 package primitive
 
+// State is a shape being optimized. An Alpha of zero is solved along with
+// the shape's color each time it is scored, rather than searched for.
 type State struct {
-	Worker      *Worker
-	Shape       Shape
-	Alpha       int
-	MutateAlpha bool
-	Score       float64
+	Worker *Worker
+	Shape  Shape
+	Alpha  int
+	Score  float64
 }
 
 func NewState(worker *Worker, shape Shape, alpha int) *State {
-	var mutateAlpha bool
-	if alpha == 0 {
-		alpha = 128
-		mutateAlpha = true
-	}
-	return &State{worker, shape, alpha, mutateAlpha, -1}
+	return &State{worker, shape, alpha, -1}
 }
 
 func (state *State) Energy() float64 {
@@ -25,12 +21,8 @@ func (state *State) Energy() float64 {
 }
 
 func (state *State) DoMove() interface{} {
-	rnd := state.Worker.Rnd
 	oldState := state.Copy()
 	state.Shape.Mutate()
-	if state.MutateAlpha {
-		state.Alpha = clampInt(state.Alpha+rnd.Intn(21)-10, 1, 255)
-	}
 	state.Score = -1
 	return oldState
 }
@@ -43,6 +35,5 @@ func (state *State) UndoMove(undo interface{}) {
 }
 
 func (state *State) Copy() Annealable {
-	return &State{
-		state.Worker, state.Shape.Copy(), state.Alpha, state.MutateAlpha, state.Score}
+	return &State{state.Worker, state.Shape.Copy(), state.Alpha, state.Score}
 }
@@ -0,0 +1,470 @@
+package primitive
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	svgTransformPattern = regexp.MustCompile(`(\w+)\(([^)]*)\)`)
+	svgPathPattern      = regexp.MustCompile(`^M\s*(\S+)\s+(\S+)\s*Q\s*(\S+)\s+(\S+),\s*(\S+)\s+(\S+)$`)
+	svgCubicPattern     = regexp.MustCompile(`^M\s*(\S+)\s+(\S+)\s*C\s*(\S+)\s+(\S+),\s*(\S+)\s+(\S+),\s*(\S+)\s+(\S+)$`)
+	svgBlobPattern      = regexp.MustCompile(`^M\s*(\S+)\s+(\S+)((?:\s*C\s*\S+\s+\S+,\s*\S+\s+\S+,\s*\S+\s+\S+)+)\s*Z$`)
+)
+
+// ReadSVG parses an SVG document written by Model.SVG back into a shape
+// file. Documents from other sources are not supported.
+func ReadSVG(r io.Reader) (*ShapeFile, error) {
+	decoder := xml.NewDecoder(r)
+	file := &ShapeFile{
+		Background: Color{R: 0, G: 0, B: 0, A: 255},
+		Shapes:     nil,
+		Blend:      BlendNormal,
+		Width:      0,
+		Height:     0,
+	}
+	var sw, sh int
+	var scale float64
+	var group []svgTransform // transform of the enclosing per-shape <g>
+	gradients := make(map[string]*svgGradient)
+	var gradient *svgGradient // the gradient whose stops are being read
+	depth := 0
+	defs := 0 // depth of the enclosing <defs>, which holds no shapes
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch el := token.(type) {
+		case xml.EndElement:
+			if depth == defs {
+				defs = 0
+			}
+			depth--
+			if depth == 2 {
+				group = nil
+			}
+		case xml.StartElement:
+			depth++
+			attrs := svgAttrs(el.Attr)
+			if defs > 0 {
+				switch el.Name.Local {
+				case "linearGradient", "radialGradient":
+					gradient, err = parseSVGGradient(el.Name.Local, attrs)
+					if err != nil {
+						return nil, err
+					}
+					gradients[attrs["id"]] = gradient
+				case "stop":
+					if gradient == nil {
+						return nil, errors.New("svg: <stop> outside of a gradient")
+					}
+					c, err := svgColor(attrs, "stop-color", "stop-opacity")
+					if err != nil {
+						return nil, err
+					}
+					gradient.Stops = append(gradient.Stops, c)
+				}
+				continue
+			}
+			switch {
+			case el.Name.Local == "defs":
+				defs = depth
+			case depth == 1 && el.Name.Local == "svg":
+				sw, _ = strconv.Atoi(attrs["width"])
+				sh, _ = strconv.Atoi(attrs["height"])
+			case depth == 2 && el.Name.Local == "rect":
+				bg, err := MakeHexColor(attrs["fill"])
+				if err != nil {
+					return nil, err
+				}
+				file.Background = *bg
+			case depth == 2 && el.Name.Local == "g":
+				for _, t := range parseSVGTransform(attrs["transform"]) {
+					if t.Name == "scale" && len(t.Args) > 0 {
+						scale = t.Args[0]
+					}
+				}
+			case depth == 3 && el.Name.Local == "g":
+				group = parseSVGTransform(attrs["transform"])
+			case depth >= 3:
+				record, err := parseSVGShape(el.Name.Local, attrs, group, gradients)
+				if err != nil {
+					return nil, err
+				}
+				if file.Blend, err = parseSVGBlendMode(attrs["style"]); err != nil {
+					return nil, err
+				}
+				file.Shapes = append(file.Shapes, record)
+			}
+		}
+	}
+	if scale <= 0 {
+		return nil, errors.New("svg: missing scale transform")
+	}
+	file.Width = int(math.Round(float64(sw) / scale))
+	file.Height = int(math.Round(float64(sh) / scale))
+	return file, nil
+}
+
+func LoadSVG(path string) (*ShapeFile, error) {
+	if path == "-" {
+		return ReadSVG(os.Stdin)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadSVG(file)
+}
+
+type svgTransform struct {
+	Name string
+	Args []float64
+}
+
+func parseSVGTransform(s string) []svgTransform {
+	var result []svgTransform
+	for _, m := range svgTransformPattern.FindAllStringSubmatch(s, -1) {
+		args, err := parseSVGNumbers(m[2])
+		if err != nil {
+			continue
+		}
+		result = append(result, svgTransform{m[1], args})
+	}
+	return result
+}
+
+func parseSVGNumbers(s string) ([]float64, error) {
+	fields := strings.Fields(strings.ReplaceAll(s, ",", " "))
+	result := make([]float64, len(fields))
+	for i, field := range fields {
+		x, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = x
+	}
+	return result, nil
+}
+
+func svgAttrs(attrs []xml.Attr) map[string]string {
+	result := make(map[string]string, len(attrs))
+	for _, attr := range attrs {
+		result[attr.Name.Local] = attr.Value
+	}
+	return result
+}
+
+func svgColor(attrs map[string]string, name, opacityName string) (Color, error) {
+	c, err := MakeHexColor(attrs[name])
+	if err != nil {
+		return Color{}, err
+	}
+	if opacity, ok := attrs[opacityName]; ok {
+		a, err := strconv.ParseFloat(opacity, 64)
+		if err != nil {
+			return Color{}, err
+		}
+		c.A = clampInt(int(math.Round(a*255)), 0, 255)
+	}
+	return *c, nil
+}
+
+func svgFloats(attrs map[string]string, names ...string) ([]float64, error) {
+	result := make([]float64, len(names))
+	for i, name := range names {
+		x, err := strconv.ParseFloat(attrs[name], 64)
+		if err != nil {
+			return nil, fmt.Errorf("svg: attribute %s: %w", name, err)
+		}
+		result[i] = x
+	}
+	return result, nil
+}
+
+// parseSVGBlendMode reads the mix-blend-mode of a shape's style. Model.SVG
+// gives every shape the same one.
+func parseSVGBlendMode(style string) (BlendMode, error) {
+	for _, decl := range strings.Split(style, ";") {
+		name, value, _ := strings.Cut(decl, ":")
+		if strings.TrimSpace(name) != "mix-blend-mode" {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		for i, v := range svgBlendModes {
+			if v == value {
+				return BlendMode(i), nil
+			}
+		}
+		return BlendNormal, fmt.Errorf("svg: unsupported mix-blend-mode %q", value)
+	}
+	return BlendNormal, nil
+}
+
+// svgGradient is a gradient definition read from an SVG document. Its
+// geometry is in the image's coordinates; any gradientTransform only undoes
+// the transform of the shape that uses it.
+type svgGradient struct {
+	Stops    []Color
+	Gradient Gradient
+}
+
+func parseSVGGradient(name string, attrs map[string]string) (*svgGradient, error) {
+	g := &svgGradient{
+		Stops:    nil,
+		Gradient: Gradient{Radial: false, X1: 0, Y1: 0, X2: 0, Y2: 0, R: 0, Color: Color{R: 0, G: 0, B: 0, A: 0}},
+	}
+	if name == "radialGradient" {
+		p, err := svgFloats(attrs, "cx", "cy", "r")
+		if err != nil {
+			return nil, err
+		}
+		g.Gradient.Radial = true
+		g.Gradient.X1, g.Gradient.Y1, g.Gradient.R = p[0], p[1], p[2]
+		return g, nil
+	}
+	p, err := svgFloats(attrs, "x1", "y1", "x2", "y2")
+	if err != nil {
+		return nil, err
+	}
+	g.Gradient.X1, g.Gradient.Y1, g.Gradient.X2, g.Gradient.Y2 = p[0], p[1], p[2], p[3]
+	return g, nil
+}
+
+// svgPaint reads the color of a shape, or the start color and gradient of
+// a shape that refers to a gradient with url(#id).
+func svgPaint(attrs map[string]string, paint string, gradients map[string]*svgGradient) (Color, *Gradient, error) {
+	ref, ok := strings.CutPrefix(attrs[paint], "url(#")
+	if !ok {
+		c, err := svgColor(attrs, paint, paint+"-opacity")
+		return c, nil, err
+	}
+	id := strings.TrimSuffix(ref, ")")
+	g, ok := gradients[id]
+	if !ok || len(g.Stops) != 2 {
+		return Color{}, nil, fmt.Errorf("svg: unsupported gradient %q", id)
+	}
+	gradient := g.Gradient
+	gradient.Color = g.Stops[1]
+	return g.Stops[0], &gradient, nil
+}
+
+func parseSVGShape(name string, attrs map[string]string, group []svgTransform, gradients map[string]*svgGradient) (ShapeRecord, error) {
+	record := ShapeRecord{Type: "", Gradient: nil, Params: nil, Color: Color{R: 0, G: 0, B: 0, A: 0}, Score: 0}
+	paint := "fill"
+	if attrs["fill"] == "none" {
+		paint = "stroke"
+	}
+	c, g, err := svgPaint(attrs, paint, gradients)
+	if err != nil {
+		return record, err
+	}
+	record.Color = c
+	record.Gradient = g
+
+	if group != nil {
+		var params []float64
+		for _, t := range group {
+			params = append(params, t.Args...)
+		}
+		if name == "ellipse" && paint == "stroke" && len(params) == 3 {
+			// an outlined rotated ellipse is not scaled, so that its stroke
+			// is not either
+			radii, err := svgFloats(attrs, "rx", "ry")
+			if err != nil {
+				return record, err
+			}
+			record.Type = ShapeTypeRotatedEllipse.String()
+			record.Params = []float64{params[0], params[1], radii[0], radii[1], params[2]}
+			return parseSVGOutline(record, attrs)
+		}
+		if len(params) != 5 {
+			return record, fmt.Errorf("svg: unexpected transform on <%s>", name)
+		}
+		if glyph := []rune(attrs["data-glyph"]); name == "path" && len(glyph) == 1 {
+			// translate(x y) rotate(angle) scale(size size) to x, y, size, angle
+			record.Type = ShapeTypeGlyph.String()
+			record.Params = []float64{params[0], params[1], params[3], params[2], float64(glyph[0])}
+			return record, nil
+		}
+		if name == "rect" && attrs["mask"] != "" {
+			size, err := svgFloats(attrs, "width", "height")
+			if err != nil {
+				return record, err
+			}
+			// translate(x y) rotate(angle) scale(k k) to x, y, size, angle
+			record.Type = ShapeTypeStamp.String()
+			record.Params = []float64{params[0], params[1], params[3] * math.Max(size[0], size[1]), params[2]}
+			return record, nil
+		}
+		switch name {
+		case "polygon":
+			return parseSVGVertices(record, attrs, params)
+		case "rect":
+			record.Type = ShapeTypeRotatedRectangle.String()
+		case "ellipse":
+			record.Type = ShapeTypeRotatedEllipse.String()
+		default:
+			return record, fmt.Errorf("svg: unexpected transformed <%s>", name)
+		}
+		// translate(x y) rotate(angle) scale(sx sy) to x, y, sx, sy, angle
+		record.Params = []float64{params[0], params[1], params[3], params[4], params[2]}
+		return record, nil
+	}
+
+	switch name {
+	default:
+		return record, fmt.Errorf("svg: unsupported element <%s>", name)
+	case "polygon":
+		params, err := parseSVGNumbers(attrs["points"])
+		if err != nil {
+			return record, err
+		}
+		record.Type = ShapeTypePolygon.String()
+		if len(params) == 6 && attrs["data-shape"] != ShapeTypePolygon.String() {
+			record.Type = ShapeTypeTriangle.String()
+		}
+		record.Params = params
+		return parseSVGOutline(record, attrs)
+	case "rect":
+		params, err := svgFloats(attrs, "x", "y", "width", "height")
+		if err != nil {
+			return record, err
+		}
+		params[2] += params[0] - 1
+		params[3] += params[1] - 1
+		record.Type = ShapeTypeRectangle.String()
+		record.Params = params
+	case "ellipse":
+		params, err := svgFloats(attrs, "cx", "cy", "rx", "ry")
+		if err != nil {
+			return record, err
+		}
+		record.Type = ShapeTypeEllipse.String()
+		if params[2] == params[3] {
+			record.Type = ShapeTypeCircle.String()
+		}
+		record.Params = params
+		return parseSVGOutline(record, attrs)
+	case "path":
+		return parseSVGPath(record, attrs)
+	case "line":
+		params, err := svgFloats(attrs, "x1", "y1", "x2", "y2", "stroke-width")
+		if err != nil {
+			return record, err
+		}
+		c, err := ParseLineCap(attrs["stroke-linecap"])
+		if err != nil {
+			return record, err
+		}
+		record.Type = ShapeTypeLine.String()
+		record.Params = append(params, float64(c))
+	case "polyline":
+		params, err := parseSVGNumbers(attrs["points"])
+		if err != nil {
+			return record, err
+		}
+		style, err := svgFloats(attrs, "stroke-width")
+		if err != nil {
+			return record, err
+		}
+		c, err := ParseLineCap(attrs["stroke-linecap"])
+		if err != nil {
+			return record, err
+		}
+		j, err := ParseLineJoin(attrs["stroke-linejoin"])
+		if err != nil {
+			return record, err
+		}
+		record.Type = ShapeTypePolyline.String()
+		record.Params = append(params, style[0], float64(c), float64(j))
+	}
+	return record, nil
+}
+
+func parseSVGPath(record ShapeRecord, attrs map[string]string) (ShapeRecord, error) {
+	d := strings.TrimSpace(attrs["d"])
+	if m := svgBlobPattern.FindStringSubmatch(d); m != nil {
+		// keep the end point of each segment; the last one closes the blob
+		params, err := parseSVGNumbers(strings.ReplaceAll(strings.Join(m[1:], " "), "C", " "))
+		if err != nil {
+			return record, err
+		}
+		points := []float64{params[0], params[1]}
+		for i := 2; i+6 < len(params); i += 6 {
+			points = append(points, params[i+4], params[i+5])
+		}
+		record.Type = ShapeTypeBlob.String()
+		record.Params = points
+		return record, nil
+	}
+	t := ShapeTypeQuadratic
+	m := svgPathPattern.FindStringSubmatch(d)
+	if m == nil {
+		t = ShapeTypeCubic
+		m = svgCubicPattern.FindStringSubmatch(d)
+	}
+	if m == nil {
+		return record, fmt.Errorf("svg: unsupported path %q", attrs["d"])
+	}
+	params, err := parseSVGNumbers(strings.Join(m[1:], " ") + " " + attrs["stroke-width"])
+	if err != nil {
+		return record, err
+	}
+	record.Type = t.String()
+	record.Params = params
+	return record, nil
+}
+
+// parseSVGOutline appends the stroke width of an outlined triangle,
+// polygon or ellipse to its params. Filled shapes are left as they are.
+func parseSVGOutline(record ShapeRecord, attrs map[string]string) (ShapeRecord, error) {
+	if attrs["fill"] != "none" {
+		return record, nil
+	}
+	width, err := svgFloats(attrs, "stroke-width")
+	if err != nil {
+		return record, err
+	}
+	record.Params = append(record.Params, width[0])
+	return record, nil
+}
+
+// parseSVGVertices reads a regular polygon or star written by svgVertices.
+// A star's unit vertices alternate between two distances from the center;
+// a regular polygon's are all on the unit circle.
+func parseSVGVertices(record ShapeRecord, attrs map[string]string, group []float64) (ShapeRecord, error) {
+	points, err := parseSVGNumbers(attrs["points"])
+	if err != nil {
+		return record, err
+	}
+	n := len(points) / 2
+	if n < 3 || len(points)%2 != 0 {
+		return record, fmt.Errorf("svg: unexpected transformed polygon %q", attrs["points"])
+	}
+	// translate(x y) rotate(angle) scale(r r) to x, y, r, angle
+	params := []float64{group[0], group[1], group[3], group[2]}
+	// the vertices are written to six decimals, which is all the precision
+	// the ratio can have
+	inner := math.Round(math.Hypot(points[2], points[3])*1e6) / 1e6
+	if math.Abs(inner-1) < 1e-3 {
+		record.Type = ShapeTypeRegularPolygon.String()
+		record.Params = append(params, float64(n))
+		return record, nil
+	}
+	record.Type = ShapeTypeStar.String()
+	record.Params = append(params, float64(n/2), inner)
+	return record, nil
+}
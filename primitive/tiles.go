@@ -0,0 +1,227 @@
+package primitive
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+)
+
+// tile is one cell of the grid StepTiles searches: workers whose target
+// and canvas are the cell's part of the model's, one for each hill climb
+// of the cell, and the cell's offset.
+type tile struct {
+	workers []*Worker
+	rect    image.Rectangle
+}
+
+// tileClimbs is how many hill climbs a tiled step runs in all, as Step does.
+const tileClimbs = 16
+
+// tiles returns the cells of an n x n grid over the canvas, creating
+// their workers the first time a grid of that size is used.
+func (model *Model) tiles(n int) []tile {
+	if model.tileGrid == n {
+		return model.tileCells
+	}
+	w := model.Target.Bounds().Dx()
+	h := model.Target.Bounds().Dy()
+	m := max(1, (tileClimbs+n*n-1)/(n*n))
+	model.tileCells = nil
+	for j := range n {
+		for i := range n {
+			r := image.Rect(w*i/n, h*j/n, w*(i+1)/n, h*(j+1)/n)
+			if r.Empty() {
+				continue
+			}
+			target := cropRGBA(model.Target, r)
+			workers := make([]*Worker, m)
+			for k := range workers {
+				workers[k] = NewWorker(target)
+			}
+			model.tileCells = append(model.tileCells, tile{workers: workers, rect: r})
+		}
+	}
+	model.tileGrid = n
+	return model.tileCells
+}
+
+// cropRGBA returns a copy of the r part of im with its origin at 0, 0.
+func cropRGBA(im *image.RGBA, r image.Rectangle) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i := im.PixOffset(r.Min.X, y)
+		copy(dst.Pix[dst.PixOffset(0, y-r.Min.Y):], im.Pix[i:i+r.Dx()*4])
+	}
+	return dst
+}
+
+// StepTiles is like Step, but splits the canvas into an n x n grid of
+// tiles and searches each tile on its own, all at once. The best shape
+// found is always added if it meets its constraints; the best of each
+// other tile is added too if it improves the score and its bounds overlap
+// none of the shapes added before it, as such shapes do not change each
+// other's scores. On large canvases this adds several shapes for little
+// more than the cost of one. It fails if a tile's shape cannot be moved
+// onto the canvas, which only shapes of the built-in types can.
+func (model *Model) StepTiles(ctx context.Context, shapeType ShapeType, alpha, n int) (int, error) {
+	if model.pool == nil {
+		model.pool = newPool(model)
+	}
+	for _, worker := range model.Workers {
+		worker.Init(model.Current, model.Total)
+	}
+	tiles := model.tiles(n)
+	full := model.Workers[0]
+	var tasks []climbTask
+	for _, t := range tiles {
+		current := cropRGBA(model.Current, t.rect)
+		total := sumRows(rowErrors(t.workers[0].Target, current))
+		for _, worker := range t.workers {
+			worker.Options = full.Options
+			// spawn and move shapes as far as on the whole canvas
+			worker.StepScale = full.StepScale * full.canvasScale() / worker.canvasScale()
+			worker.Init(current, total)
+			tasks = append(tasks, climbTask{index: len(tasks), seed: model.rnd.Int63(), t: shapeType, alpha: alpha, n: 1000, age: 100, worker: worker})
+		}
+	}
+	states := model.pool.run(ctx, tasks)
+
+	type candidate struct {
+		shape  Shape
+		alpha  int
+		energy float64
+		bounds image.Rectangle
+	}
+	candidates := make([]candidate, len(tiles))
+	for i, t := range tiles {
+		m := len(t.workers)
+		state := bestState(states[i*m : (i+1)*m])
+		shape, err := translateShape(state.Shape, full, t.rect.Min.X, t.rect.Min.Y)
+		if err != nil {
+			return 0, err
+		}
+		candidates[i] = candidate{
+			shape:  shape,
+			alpha:  state.Alpha,
+			energy: full.Energy(shape, state.Alpha),
+			bounds: linesBounds(shape.Rasterize()),
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].energy < candidates[j].energy
+	})
+
+	score := model.Score
+	var added []image.Rectangle
+	for i, c := range candidates {
+		if math.IsInf(c.energy, 1) || i > 0 && (c.energy >= score || overlapsAny(c.bounds, added)) {
+			continue
+		}
+		model.Add(c.shape, c.alpha)
+		added = append(added, c.bounds)
+	}
+
+	counter := 0
+	for _, worker := range model.Workers {
+		counter += worker.Counter
+	}
+	return counter, nil
+}
+
+// linesBounds returns the smallest rectangle holding the scanlines.
+func linesBounds(lines []Scanline) image.Rectangle {
+	var r image.Rectangle
+	for _, line := range lines {
+		r = r.Union(image.Rect(line.X1, line.Y, line.X2+1, line.Y+1))
+	}
+	return r
+}
+
+func overlapsAny(r image.Rectangle, rects []image.Rectangle) bool {
+	for _, s := range rects {
+		if r.Overlaps(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// translateShape returns a copy of shape moved by dx, dy and bound to
+// worker. Shapes that are not one of the built-in types cannot be moved.
+func translateShape(shape Shape, worker *Worker, dx, dy int) (Shape, error) {
+	fx, fy := float64(dx), float64(dy)
+	switch t := shape.Copy().(type) {
+	case *Triangle:
+		t.Worker = worker
+		t.X1, t.Y1, t.X2, t.Y2, t.X3, t.Y3 = t.X1+dx, t.Y1+dy, t.X2+dx, t.Y2+dy, t.X3+dx, t.Y3+dy
+		return t, nil
+	case *Rectangle:
+		t.Worker = worker
+		t.X1, t.Y1, t.X2, t.Y2 = t.X1+dx, t.Y1+dy, t.X2+dx, t.Y2+dy
+		return t, nil
+	case *Ellipse:
+		t.Worker = worker
+		t.X, t.Y = t.X+dx, t.Y+dy
+		return t, nil
+	case *RotatedRectangle:
+		t.Worker = worker
+		t.X, t.Y = t.X+dx, t.Y+dy
+		return t, nil
+	case *Quadratic:
+		t.Worker = worker
+		t.X1, t.Y1, t.X2, t.Y2, t.X3, t.Y3 = t.X1+fx, t.Y1+fy, t.X2+fx, t.Y2+fy, t.X3+fx, t.Y3+fy
+		return t, nil
+	case *RotatedEllipse:
+		t.Worker = worker
+		t.X, t.Y = t.X+fx, t.Y+fy
+		return t, nil
+	case *Polygon:
+		t.Worker = worker
+		translatePoints(t.X, t.Y, fx, fy)
+		return t, nil
+	case *Cubic:
+		t.Worker = worker
+		t.X1, t.Y1, t.X2, t.Y2 = t.X1+fx, t.Y1+fy, t.X2+fx, t.Y2+fy
+		t.X3, t.Y3, t.X4, t.Y4 = t.X3+fx, t.Y3+fy, t.X4+fx, t.Y4+fy
+		return t, nil
+	case *Blob:
+		t.Worker = worker
+		translatePoints(t.X, t.Y, fx, fy)
+		return t, nil
+	case *Line:
+		t.Worker = worker
+		t.X1, t.Y1, t.X2, t.Y2 = t.X1+fx, t.Y1+fy, t.X2+fx, t.Y2+fy
+		return t, nil
+	case *Polyline:
+		t.Worker = worker
+		translatePoints(t.X, t.Y, fx, fy)
+		return t, nil
+	case *Glyph:
+		t.Worker = worker
+		t.X, t.Y = t.X+fx, t.Y+fy
+		return t, nil
+	case *Stamp:
+		t.Worker = worker
+		t.X, t.Y = t.X+fx, t.Y+fy
+		return t, nil
+	case *RegularPolygon:
+		t.Worker = worker
+		t.X, t.Y = t.X+fx, t.Y+fy
+		return t, nil
+	case *Star:
+		t.Worker = worker
+		t.X, t.Y = t.X+fx, t.Y+fy
+		return t, nil
+	default:
+		return nil, fmt.Errorf("cannot translate shape %T", shape)
+	}
+}
+
+func translatePoints(x, y []float64, dx, dy float64) {
+	for i := range x {
+		x[i] += dx
+		y[i] += dy
+	}
+}
@@ -0,0 +1,101 @@
+package primitive
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// TestTranslateShape checks that a shape moved onto the full canvas covers
+// the same pixels, offset, as it did in its tile, up to antialiasing.
+func TestTranslateShape(t *testing.T) {
+	t.Parallel()
+	tileWorker := NewWorker(image.NewRGBA(image.Rect(0, 0, 32, 32)))
+	full := NewWorker(image.NewRGBA(image.Rect(0, 0, 64, 64)))
+	for _, shape := range []Shape{
+		&Triangle{tileWorker, 2, 3, 20, 5, 10, 25, 0},
+		&Rectangle{tileWorker, 4, 4, 12, 20},
+		&RotatedEllipse{tileWorker, 16, 16, 10, 5, 30, 0},
+		&Polygon{tileWorker, []float64{2, 28, 20, 4}, []float64{2, 6, 28, 22}, 4, false, 0},
+	} {
+		want := linesBounds(shape.Rasterize()).Add(image.Pt(32, 16))
+		moved, err := translateShape(shape, full, 32, 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if moved == shape {
+			t.Errorf("%T: got the shape itself, want a copy", shape)
+		}
+		got := linesBounds(moved.Rasterize())
+		if d := got.Min.Sub(want.Min); d.X < -1 || d.X > 1 || d.Y != 0 {
+			t.Errorf("%T: got bounds %v, want %v", shape, got, want)
+		}
+		if d := got.Max.Sub(want.Max); d.X < -1 || d.X > 1 || d.Y != 0 {
+			t.Errorf("%T: got bounds %v, want %v", shape, got, want)
+		}
+	}
+}
+
+// TestTranslateUnknownShape checks that tiled steps refuse shapes of
+// other types instead of crashing.
+func TestTranslateUnknownShape(t *testing.T) {
+	t.Parallel()
+	worker := NewWorker(image.NewRGBA(image.Rect(0, 0, 32, 32)))
+	shape := &unknownShape{Triangle{worker, 2, 3, 20, 5, 10, 25, 0}}
+	if _, err := translateShape(shape, worker, 1, 1); err == nil {
+		t.Error("got no error")
+	}
+}
+
+// TestStepTiles checks that a tiled step can add several shapes and that
+// the model's score stays that of its canvas.
+func TestStepTiles(t *testing.T) {
+	t.Parallel()
+	im := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			im.SetRGBA(x, y, color.RGBA{uint8(x * 4), uint8(y * 4), uint8((x + y) * 2), 255})
+		}
+	}
+	model := NewModel(im, &Color{R: 0, G: 0, B: 0, A: 255}, 64, 2)
+	defer model.Close()
+	model.Seed(1)
+	before := model.Score
+	if _, err := model.StepTiles(context.Background(), ShapeTypeRectangle, 128, 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(model.Shapes) < 2 {
+		t.Errorf("added %d shapes, want several", len(model.Shapes))
+	}
+	if model.Score >= before {
+		t.Errorf("score went from %f to %f", before, model.Score)
+	}
+	if want := differenceFull(model.Target, model.Current); math.Abs(model.Score-want) > 1e-6 {
+		t.Errorf("score is %f, want %f", model.Score, want)
+	}
+	for _, shape := range model.Shapes {
+		if w := shape.(*Rectangle).Worker; w != model.Workers[0] {
+			t.Errorf("shape bound to a tile's worker")
+		}
+	}
+}
+
+// TestStepTilesSpreads checks that a tiled step runs each tile's climbs as
+// separate tasks, so that more workers than tiles can share the work.
+func TestStepTilesSpreads(t *testing.T) {
+	t.Parallel()
+	model := poolTestModel(8)
+	defer model.Close()
+	if _, err := model.StepTiles(context.Background(), ShapeTypeTriangle, 128, 2); err != nil {
+		t.Fatal(err)
+	}
+	tasks := 0
+	for _, worker := range model.Workers {
+		tasks += worker.Tasks
+	}
+	if tasks != tileClimbs {
+		t.Errorf("ran %d tasks for 4 tiles, want one for each of %d climbs", tasks, tileClimbs)
+	}
+}
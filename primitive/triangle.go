@@ -8,31 +8,34 @@ import (
 )
 
 type Triangle struct {
-	Worker *Worker
-	X1, Y1 int
-	X2, Y2 int
-	X3, Y3 int
+	Worker  *Worker
+	X1, Y1  int
+	X2, Y2  int
+	X3, Y3  int
+	Outline float64
 }
 
 func NewRandomTriangle(worker *Worker) *Triangle {
 	rnd := worker.Rnd
 	x1 := rnd.Intn(worker.W)
 	y1 := rnd.Intn(worker.H)
-	x2 := x1 + rnd.Intn(31) - 15
-	y2 := y1 + rnd.Intn(31) - 15
-	x3 := x1 + rnd.Intn(31) - 15
-	y3 := y1 + rnd.Intn(31) - 15
-	t := &Triangle{worker, x1, y1, x2, y2, x3, y3}
+	x2 := x1 + worker.spawnInt(rnd.Intn(31)-15)
+	y2 := y1 + worker.spawnInt(rnd.Intn(31)-15)
+	x3 := x1 + worker.spawnInt(rnd.Intn(31)-15)
+	y3 := y1 + worker.spawnInt(rnd.Intn(31)-15)
+	t := &Triangle{worker, x1, y1, x2, y2, x3, y3, worker.Options.Outline}
 	t.Mutate()
 	return t
 }
 
 func (t *Triangle) Draw(dc *gg.Context, scale float64) {
+	dc.Push()
 	dc.LineTo(float64(t.X1), float64(t.Y1))
 	dc.LineTo(float64(t.X2), float64(t.Y2))
 	dc.LineTo(float64(t.X3), float64(t.Y3))
 	dc.ClosePath()
-	dc.Fill()
+	fillOrStroke(dc, t.Outline, scale)
+	dc.Pop()
 }
 
 func (t *Triangle) SVG(attrs string) string {
@@ -41,6 +44,10 @@ func (t *Triangle) SVG(attrs string) string {
 		attrs, t.X1, t.Y1, t.X2, t.Y2, t.X3, t.Y3)
 }
 
+func (t *Triangle) outlineWidth() float64 {
+	return t.Outline
+}
+
 func (t *Triangle) Copy() Shape {
 	a := *t
 	return &a
@@ -50,27 +57,36 @@ func (t *Triangle) Mutate() {
 	w := t.Worker.W
 	h := t.Worker.H
 	rnd := t.Worker.Rnd
-	const m = 16
-	for {
+	limits := t.Worker.constraints(ShapeTypeTriangle)
+	m := int(limits.Margin)
+	saved := *t
+	for range mutateTries {
 		switch rnd.Intn(3) {
 		case 0:
-			t.X1 = clampInt(t.X1+int(rnd.NormFloat64()*16), -m, w-1+m)
-			t.Y1 = clampInt(t.Y1+int(rnd.NormFloat64()*16), -m, h-1+m)
+			t.X1 = clampInt(t.X1+int(rnd.NormFloat64()*limits.Step), -m, w-1+m)
+			t.Y1 = clampInt(t.Y1+int(rnd.NormFloat64()*limits.Step), -m, h-1+m)
 		case 1:
-			t.X2 = clampInt(t.X2+int(rnd.NormFloat64()*16), -m, w-1+m)
-			t.Y2 = clampInt(t.Y2+int(rnd.NormFloat64()*16), -m, h-1+m)
+			t.X2 = clampInt(t.X2+int(rnd.NormFloat64()*limits.Step), -m, w-1+m)
+			t.Y2 = clampInt(t.Y2+int(rnd.NormFloat64()*limits.Step), -m, h-1+m)
 		case 2:
-			t.X3 = clampInt(t.X3+int(rnd.NormFloat64()*16), -m, w-1+m)
-			t.Y3 = clampInt(t.Y3+int(rnd.NormFloat64()*16), -m, h-1+m)
+			t.X3 = clampInt(t.X3+int(rnd.NormFloat64()*limits.Step), -m, w-1+m)
+			t.Y3 = clampInt(t.Y3+int(rnd.NormFloat64()*limits.Step), -m, h-1+m)
 		}
 		if t.Valid() {
-			break
+			return
 		}
 	}
+	*t = saved
 }
 
 func (t *Triangle) Valid() bool {
-	const minDegrees = 15
+	limits := t.Worker.constraints(ShapeTypeTriangle)
+	x1, x2 := minInt(t.X1, minInt(t.X2, t.X3)), maxInt(t.X1, maxInt(t.X2, t.X3))
+	y1, y2 := minInt(t.Y1, minInt(t.Y2, t.Y3)), maxInt(t.Y1, maxInt(t.Y2, t.Y3))
+	if !limits.fits(float64(x2-x1), float64(y2-y1)) {
+		return false
+	}
+	minDegrees := limits.MinAngle
 	var a1, a2, a3 float64
 	{
 		x1 := float64(t.X2 - t.X1)
@@ -103,6 +119,11 @@ func (t *Triangle) Valid() bool {
 }
 
 func (t *Triangle) Rasterize() []Scanline {
+	if t.Outline > 0 {
+		x := []float64{float64(t.X1), float64(t.X2), float64(t.X3)}
+		y := []float64{float64(t.Y1), float64(t.Y2), float64(t.Y3)}
+		return strokeOutline(t.Worker, closedPath(x, y), t.Outline)
+	}
 	buf := t.Worker.Lines[:0]
 	lines := rasterizeTriangle(t.X1, t.Y1, t.X2, t.Y2, t.X3, t.Y3, buf)
 	return cropScanlines(lines, t.Worker.W, t.Worker.H)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"image"
 	"log/slog"
+	"math"
 	"math/rand"
 	"time"
 
@@ -18,10 +19,16 @@ type Worker struct {
 	Heatmap    *Heatmap
 	Rnd        *rand.Rand
 	Lines      []Scanline
+	Options    ShapeOptions
+	StepScale  float64 // shrinks spawn and mutation distances; see Model.anneal
 	W          int
 	H          int
 	Score      float64
-	Counter    int
+	Total      uint64        // the sum of squared differences Score stands for
+	Counter    int           // shapes scored during the step
+	Tasks      int           // hill climbs run during the step
+	Steals     int           // hill climbs taken from other workers' queues
+	Busy       time.Duration // time spent in hill climbs during the step
 }
 
 func NewWorker(target *image.RGBA) *Worker {
@@ -36,28 +43,85 @@ func NewWorker(target *image.RGBA) *Worker {
 		Lines:      make([]Scanline, 0, 4096), // TODO: based on height
 		Heatmap:    NewHeatmap(w, h),
 		Rnd:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		Options:    DefaultShapeOptions(),
+		StepScale:  1,
 		Current:    nil,
 		Score:      0,
+		Total:      0,
 		Counter:    0,
+		Tasks:      0,
+		Steals:     0,
+		Busy:       0,
 	}
 	return &worker
 }
 
-func (worker *Worker) Init(current *image.RGBA, score float64) {
+// canvasScale is the size of the canvas relative to the 256 pixels that
+// the default spawn and mutation distances are tuned for.
+func (worker *Worker) canvasScale() float64 {
+	return float64(maxInt(worker.W, worker.H)) / 256
+}
+
+// spawnScale scales the size of new random shapes.
+func (worker *Worker) spawnScale() float64 {
+	return worker.canvasScale() * worker.StepScale
+}
+
+// spawnInt scales a random offset or extent of a new shape.
+func (worker *Worker) spawnInt(n int) int {
+	return int(math.Round(float64(n) * worker.spawnScale()))
+}
+
+// Init sets the canvas the worker scores shapes on, whose squared
+// differences from the target sum to total, and clears its statistics.
+func (worker *Worker) Init(current *image.RGBA, total uint64) {
 	worker.Current = current
-	worker.Score = score
+	worker.Total = total
+	worker.Score = errorScore(total, worker.W, worker.H)
 	worker.Counter = 0
+	worker.Tasks = 0
+	worker.Steals = 0
+	worker.Busy = 0
 	worker.Heatmap.Clear()
 }
 
+// WorkerStats describes what a worker did during a step.
+type WorkerStats struct {
+	Evaluations int
+	Tasks       int
+	Steals      int
+	Busy        time.Duration
+}
+
+func (worker *Worker) Stats() WorkerStats {
+	return WorkerStats{
+		Evaluations: worker.Counter,
+		Tasks:       worker.Tasks,
+		Steals:      worker.Steals,
+		Busy:        worker.Busy,
+	}
+}
+
 func (worker *Worker) Energy(shape Shape, alpha int) float64 {
 	worker.Counter++
+	if s, ok := shape.(validShape); ok && !s.Valid() {
+		return math.Inf(1)
+	}
 	lines := shape.Rasterize()
 	// worker.Heatmap.Add(lines)
-	color := computeColor(worker.Target, worker.Current, lines, alpha)
+	color, gradient := computePaint(worker.Target, worker.Current, lines, alpha, &worker.Options)
+	if gradient == nil && worker.Options.Blend == BlendNormal {
+		return worker.score(energyLines(worker.Target, worker.Current, color, lines))
+	}
 	copyLines(worker.Buffer, worker.Current, lines)
-	drawLines(worker.Buffer, color, lines)
-	return differencePartial(worker.Target, worker.Current, worker.Buffer, worker.Score, lines)
+	drawPaint(worker.Buffer, color, gradient, worker.Options.Blend, lines)
+	return worker.score(differencePartial(worker.Target, worker.Current, worker.Buffer, lines))
+}
+
+// score returns the score of the canvas once its sum of squared
+// differences changes by delta.
+func (worker *Worker) score(delta int64) float64 {
+	return errorScore(uint64(int64(worker.Total)+delta), worker.W, worker.H)
 }
 
 func (worker *Worker) BestHillClimbState(ctx context.Context, t ShapeType, a, n, age, m int) *State {
@@ -94,7 +158,7 @@ func (worker *Worker) BestRandomState(t ShapeType, a, n int) *State {
 func (worker *Worker) RandomState(t ShapeType, a int) *State {
 	switch t {
 	default:
-		return worker.RandomState(ShapeType(worker.Rnd.Intn(8)+1), a)
+		return worker.RandomState(worker.randomShapeType(), a)
 	case ShapeTypeTriangle:
 		return NewState(worker, NewRandomTriangle(worker), a)
 	case ShapeTypeRectangle:
@@ -110,6 +174,37 @@ func (worker *Worker) RandomState(t ShapeType, a int) *State {
 	case ShapeTypeRotatedEllipse:
 		return NewState(worker, NewRandomRotatedEllipse(worker), a)
 	case ShapeTypePolygon:
-		return NewState(worker, NewRandomPolygon(worker, 4, false), a)
+		return NewState(worker, NewRandomPolygon(worker, worker.Options.polygonOrder(t), worker.Options.PolygonConvex), a)
+	case ShapeTypeCubic:
+		return NewState(worker, NewRandomCubic(worker), a)
+	case ShapeTypeBlob:
+		return NewState(worker, NewRandomBlob(worker, 4), a)
+	case ShapeTypeLine:
+		return NewState(worker, NewRandomLine(worker), a)
+	case ShapeTypePolyline:
+		return NewState(worker, NewRandomPolyline(worker, 4), a)
+	case ShapeTypeGlyph:
+		return NewState(worker, NewRandomGlyph(worker), a)
+	case ShapeTypeStamp:
+		return NewState(worker, NewRandomStamp(worker), a)
+	case ShapeTypeRegularPolygon:
+		return NewState(worker, NewRandomRegularPolygon(worker, worker.Options.polygonOrder(t)), a)
+	case ShapeTypeStar:
+		return NewState(worker, NewRandomStar(worker, worker.Options.polygonOrder(t)), a)
+	}
+}
+
+// randomShapeType picks one of the shape types, leaving out glyphs and
+// stamps unless the options provide a font or sprite for them.
+func (worker *Worker) randomShapeType() ShapeType {
+	var types [ShapeTypeStar]ShapeType
+	n := 0
+	for t := ShapeTypeTriangle; t <= ShapeTypeStar; t++ {
+		if t == ShapeTypeGlyph && worker.Options.Font == nil || t == ShapeTypeStamp && worker.Options.Sprite == nil {
+			continue
+		}
+		types[n] = t
+		n++
 	}
+	return types[worker.Rnd.Intn(n)]
 }
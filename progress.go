@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/fogleman/primitive/primitive"
+)
+
+type progressStep struct {
+	Type        string              `json:"type"`
+	Workers     []int               `json:"workers"`
+	WorkerStats []progressWorker    `json:"worker_stats"`
+	ShapeType   primitive.ShapeType `json:"shape_type"`
+	Frame       int                 `json:"frame"`
+	Frames      int                 `json:"frames"`
+	Stage       int                 `json:"stage"`
+	Elapsed     float64             `json:"elapsed"`
+	Duration    float64             `json:"duration"`
+	Score       float64             `json:"score"`
+	Evaluations int                 `json:"evaluations"`
+	NPS         float64             `json:"nps"`
+	Shapes      int                 `json:"shapes"`
+	Alpha       int                 `json:"alpha"`
+}
+
+// progressWorker is what one worker did during a step.
+type progressWorker struct {
+	Evaluations int     `json:"evaluations"`
+	Tasks       int     `json:"tasks"`
+	Steals      int     `json:"steals"`
+	Busy        float64 `json:"busy"`
+}
+
+type progressSummary struct {
+	Type        string  `json:"type"`
+	Error       string  `json:"error,omitempty"`
+	Frames      int     `json:"frames"`
+	Shapes      int     `json:"shapes"`
+	Elapsed     float64 `json:"elapsed"`
+	Score       float64 `json:"score"`
+	Evaluations int     `json:"evaluations"`
+	NPS         float64 `json:"nps"`
+}
+
+// progressWriter emits one JSON object per step, followed by a summary
+// record, for consumption by dashboards and scripts.
+type progressWriter struct {
+	enc     *json.Encoder
+	summary progressSummary
+}
+
+func newProgressWriter(w io.Writer) *progressWriter {
+	return &progressWriter{
+		enc: json.NewEncoder(w),
+		summary: progressSummary{
+			Type:        "summary",
+			Error:       "",
+			Frames:      0,
+			Shapes:      0,
+			Elapsed:     0,
+			Score:       0,
+			Evaluations: 0,
+			NPS:         0,
+		},
+	}
+}
+
+func (w *progressWriter) Step(p primitive.Progress) error {
+	w.summary.Frames = p.Frame
+	w.summary.Shapes += p.Shapes
+	w.summary.Elapsed = p.Elapsed.Seconds()
+	w.summary.Score = p.Score
+	w.summary.Evaluations += p.Evaluations
+	stats := make([]progressWorker, len(p.Workers))
+	for i, s := range p.Workers {
+		stats[i] = progressWorker{
+			Evaluations: s.Evaluations,
+			Tasks:       s.Tasks,
+			Steals:      s.Steals,
+			Busy:        s.Busy.Seconds(),
+		}
+	}
+	return w.enc.Encode(progressStep{
+		Type:        "step",
+		ShapeType:   p.ShapeType,
+		Workers:     p.Counters,
+		WorkerStats: stats,
+		Frame:       p.Frame,
+		Frames:      p.Frames,
+		Stage:       p.Stage,
+		Elapsed:     p.Elapsed.Seconds(),
+		Duration:    p.Duration.Seconds(),
+		Score:       p.Score,
+		Evaluations: p.Evaluations,
+		NPS:         p.NPS(),
+		Shapes:      p.Shapes,
+		Alpha:       p.Alpha,
+	})
+}
+
+// Summary writes the totals for the run; err is the error the run ended
+// with, if any.
+func (w *progressWriter) Summary(err error) error {
+	if err != nil {
+		w.summary.Error = err.Error()
+	}
+	if w.summary.Elapsed > 0 {
+		w.summary.NPS = float64(w.summary.Evaluations) / w.summary.Elapsed
+	}
+	return w.enc.Encode(w.summary)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"path/filepath"
+	"strings"
+
+	"github.com/fogleman/primitive/primitive"
+)
+
+func doRender(ctx context.Context, args []string) error {
+	var (
+		input       string
+		outputs     flagArray
+		size        int
+		supersample int
+		native      bool
+		fontPath    string
+		spritePath  string
+	)
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	fs.StringVar(&input, "i", "", "input shape file (.json) or SVG written by primitive")
+	fs.Var(&outputs, "o", "output image path")
+	fs.IntVar(&size, "s", 1024, "output image size")
+	fs.IntVar(&supersample, "ss", 1, "supersampling factor for anti-aliasing")
+	fs.BoolVar(&native, "native", false, "render with the scanline rasterizer used for scoring instead of gg")
+	fs.StringVar(&fontPath, "font", "", "TrueType font for glyph shapes")
+	fs.StringVar(&spritePath, "sprite", "", "sprite image for stamp shapes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var err error
+	if input == "" {
+		err = errors.Join(err, errors.New("ERROR: input argument required"))
+	}
+	if len(outputs) == 0 {
+		err = errors.Join(err, errors.New("ERROR: output argument required"))
+	}
+	if size < 1 {
+		err = errors.Join(err, errors.New("ERROR: size argument must be > 0"))
+	}
+	if err != nil {
+		return err
+	}
+
+	var file *primitive.ShapeFile
+	if strings.ToLower(filepath.Ext(input)) == ".svg" {
+		file, err = primitive.LoadSVG(input)
+	} else {
+		file, err = primitive.LoadShapeFile(input)
+	}
+	if err != nil {
+		return err
+	}
+	shapeOpts := primitive.DefaultShapeOptions()
+	if fontPath != "" {
+		if shapeOpts.Font, err = primitive.LoadFont(fontPath, ""); err != nil {
+			return err
+		}
+	}
+	if spritePath != "" {
+		if shapeOpts.Sprite, err = primitive.LoadSprite(spritePath); err != nil {
+			return err
+		}
+	}
+	model, err := file.Model(size, shapeOpts)
+	if err != nil {
+		return err
+	}
+
+	opts := primitive.RenderOptions{Supersample: supersample, Native: native}
+	im := func() (image.Image, error) {
+		return renderImage(model, size, opts)
+	}
+	for _, output := range outputs {
+		ext := strings.ToLower(filepath.Ext(output))
+		if output == "-" {
+			ext = ".svg"
+		}
+		if err := saveOutput(ctx, model, output, ext, im); err != nil {
+			return fmt.Errorf("%s: %w", output, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/fogleman/primitive/primitive"
+)
+
+type reportVariant struct {
+	Score       *float64
+	Image       string
+	Mode        string
+	Error       string
+	Count       int
+	Alpha       int
+	Elapsed     float64
+	Evaluations int
+	mode        int
+}
+
+func (v reportVariant) NPS() string {
+	if v.Elapsed <= 0 {
+		return "n/a"
+	}
+	return primitive.NumberString(float64(v.Evaluations) / v.Elapsed)
+}
+
+type reportRow struct {
+	Name     string
+	Original string
+	Variants []reportVariant
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body {
+    margin: 0;
+    padding: 0;
+    font-family: sans-serif;
+}
+table {
+    border-collapse: collapse;
+    margin: 4px;
+}
+img {
+    width: {{.Width}}px;
+    display: block;
+    margin: 4px;
+}
+td {
+    padding: 0;
+    vertical-align: top;
+}
+dl {
+    display: grid;
+    grid-template-columns: auto 1fr;
+    gap: 0 8px;
+    margin: 0 4px 12px;
+    font-size: 12px;
+}
+dt {
+    color: #888;
+}
+dd {
+    margin: 0;
+}
+.error {
+    color: #c00;
+}
+</style>
+</head>
+<body>
+<table>
+{{range .Rows}}
+<tr>
+<td><img src="{{.Original}}" alt="{{.Name}}"><dl><dt>original</dt><dd>{{.Name}}</dd></dl></td>
+{{range .Variants}}
+<td>
+{{if .Error}}<p class="error">{{.Error}}</p>{{else}}<img src="{{.Image}}" alt="{{.Mode}} x {{.Count}}">{{end}}
+<dl>
+<dt>score</dt><dd>{{with .Score}}{{printf "%.6f" .}}{{else}}n/a{{end}}</dd>
+<dt>shapes</dt><dd>{{.Count}}</dd>
+<dt>mode</dt><dd>{{.Mode}}</dd>
+<dt>alpha</dt><dd>{{.Alpha}}</dd>
+<dt>elapsed</dt><dd>{{printf "%.1f" .Elapsed}}s</dd>
+<dt>nps</dt><dd>{{.NPS}}</dd>
+</dl>
+</td>
+{{end}}
+</tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
+
+func doReport(ctx context.Context, args []string) error {
+	var (
+		manifestPath string
+		output       string
+		title        string
+		width        int
+	)
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	fs.StringVar(&manifestPath, "manifest", "", "batch manifest path")
+	fs.StringVar(&output, "o", "report.html", "output HTML path")
+	fs.StringVar(&title, "title", "primitive", "page title")
+	fs.IntVar(&width, "w", 400, "displayed image width in pixels")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if manifestPath == "" {
+		return errors.New("ERROR: manifest argument required")
+	}
+	slog.DebugContext(ctx, "reading manifest", slog.String("manifest", manifestPath))
+	manifest, err := loadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	base := filepath.Dir(output)
+	if output == "-" {
+		base = "."
+	}
+	rows, err := reportRows(manifest, base)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	data := struct {
+		Title string
+		Rows  []*reportRow
+		Width int
+	}{title, rows, width}
+	if err := reportTemplate.Execute(&b, data); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "writing", slog.String("output", output))
+	return primitive.SaveFile(output, b.String())
+}
+
+// reportRows groups the manifest results by input image. Image paths are
+// made relative to base, the directory the report is written to.
+func reportRows(manifest *batchManifest, base string) ([]*reportRow, error) {
+	rel := func(path string) (string, error) {
+		dir := base
+		if filepath.IsAbs(path) != filepath.IsAbs(dir) {
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				return "", err
+			}
+			absDir, err := filepath.Abs(dir)
+			if err != nil {
+				return "", err
+			}
+			path, dir = absPath, absDir
+		}
+		r, err := filepath.Rel(dir, path)
+		if err != nil {
+			return "", err
+		}
+		return filepath.ToSlash(r), nil
+	}
+	var rows []*reportRow
+	byInput := make(map[string]*reportRow)
+	for _, result := range manifest.Results {
+		row, ok := byInput[result.Input]
+		if !ok {
+			original, err := rel(result.Input)
+			if err != nil {
+				return nil, err
+			}
+			name := filepath.Base(result.Input)
+			row = &reportRow{Name: name, Original: original, Variants: nil}
+			byInput[result.Input] = row
+			rows = append(rows, row)
+		}
+		path := result.Output
+		if strings.Contains(path, "%") {
+			path = fmt.Sprintf(path, result.Count)
+		}
+		image, err := rel(path)
+		if err != nil {
+			return nil, err
+		}
+		row.Variants = append(row.Variants, reportVariant{
+			Image:       image,
+			Mode:        primitive.ShapeType(result.Mode).String(),
+			Error:       result.Error,
+			Count:       result.Count,
+			Alpha:       result.Alpha,
+			Score:       result.Score,
+			Elapsed:     result.Elapsed,
+			Evaluations: result.Evaluations,
+			mode:        result.Mode,
+		})
+	}
+	for _, row := range rows {
+		slices.SortStableFunc(row.Variants, func(a, b reportVariant) int {
+			return cmp.Or(
+				cmp.Compare(a.mode, b.mode),
+				cmp.Compare(a.Alpha, b.Alpha),
+				cmp.Compare(a.Count, b.Count),
+			)
+		})
+	}
+	return rows, nil
+}
@@ -0,0 +1,560 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fogleman/primitive/internal/logger"
+	"github.com/fogleman/primitive/primitive"
+	"github.com/nfnt/resize"
+)
+
+const maxUploadSize = 32 << 20
+
+type jobState string
+
+const (
+	jobQueued   jobState = "queued"
+	jobRunning  jobState = "running"
+	jobDone     jobState = "done"
+	jobFailed   jobState = "failed"
+	jobCanceled jobState = "canceled"
+)
+
+func (s jobState) finished() bool {
+	return s == jobDone || s == jobFailed || s == jobCanceled
+}
+
+type jobStatus struct {
+	ID      string   `json:"id"`
+	State   jobState `json:"state"`
+	Error   string   `json:"error,omitempty"`
+	Frame   int      `json:"frame"`
+	Frames  int      `json:"frames"`
+	Score   float64  `json:"score"`
+	Elapsed float64  `json:"elapsed"`
+}
+
+type job struct {
+	input   image.Image // dropped once the job has run
+	bg      *primitive.Color
+	cancel  context.CancelFunc
+	shapes  *primitive.ShapeFile // the result, kept instead of the model
+	updated chan struct{}
+	stages  []primitive.Stage
+	status  jobStatus
+	size    int
+	mu      sync.Mutex
+}
+
+// update applies fn to the job status and wakes everyone waiting on it.
+func (j *job) update(fn func(*jobStatus)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&j.status)
+	j.notifyLocked()
+}
+
+func (j *job) notifyLocked() {
+	close(j.updated)
+	j.updated = make(chan struct{})
+}
+
+// snapshot returns the current status and a channel closed on the next
+// update.
+func (j *job) snapshot() (jobStatus, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status, j.updated
+}
+
+type server struct {
+	jobs    map[string]*job
+	queue   chan *job
+	limiter *primitive.Limiter
+	order   []string
+	workers int
+	history int
+	limits  jobLimits
+	mu      sync.Mutex
+}
+
+// jobLimits bound the parameters clients may give a job.
+type jobLimits struct {
+	count     int
+	size      int // output size
+	inputSize int
+	repeat    int
+}
+
+func doServe(ctx context.Context, args []string) error {
+	var (
+		addr       string
+		workers    int
+		concurrent int
+		queueSize  int
+		history    int
+		limits     jobLimits
+		v, vv      bool
+	)
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.StringVar(&addr, "addr", ":8080", "listen address")
+	fs.IntVar(&workers, "j", 0, "number of parallel workers shared by all jobs (default uses all cores)")
+	fs.IntVar(&concurrent, "c", 2, "number of jobs run at once")
+	fs.IntVar(&queueSize, "queue", 16, "number of jobs waiting to run before new ones are rejected")
+	fs.IntVar(&history, "history", 100, "number of finished jobs kept for download")
+	fs.IntVar(&limits.count, "max-n", 1000, "largest number of primitives a job may ask for")
+	fs.IntVar(&limits.size, "max-s", 4096, "largest output size a job may ask for")
+	fs.IntVar(&limits.inputSize, "max-r", 1024, "largest input size a job may ask for")
+	fs.IntVar(&limits.repeat, "max-rep", 10, "largest repeat count a job may ask for")
+	fs.BoolVar(&v, "v", false, "verbose")
+	fs.BoolVar(&vv, "vv", false, "very verbose")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	logLevel := slog.LevelWarn
+	if v {
+		logLevel = slog.LevelInfo
+	}
+	if vv {
+		logLevel = slog.LevelDebug
+	}
+	logger.SetupLogger(os.Stderr, logLevel)
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	s := &server{
+		jobs:    make(map[string]*job),
+		queue:   make(chan *job, max(queueSize, 0)),
+		limiter: primitive.NewLimiter(workers),
+		order:   nil,
+		workers: workers,
+		history: history,
+		limits:  limits,
+		mu:      sync.Mutex{},
+	}
+	var wg sync.WaitGroup
+	for range max(concurrent, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runJobs(ctx)
+		}()
+	}
+
+	// http.Server gains fields with Go releases, and the zero value of
+	// each is its default.
+	srv := &http.Server{ //nolint:exhaustruct
+		Addr:              addr,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext: func(_ net.Listener) context.Context {
+			return ctx
+		},
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		slog.InfoContext(ctx, "listening", slog.String("addr", addr))
+		errCh <- srv.ListenAndServe()
+	}()
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		err = srv.Shutdown(shutdownCtx)
+	}
+	wg.Wait()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", s.handleCreate)
+	mux.HandleFunc("GET /jobs/{id}", s.handleStatus)
+	mux.HandleFunc("DELETE /jobs/{id}", s.handleCancel)
+	mux.HandleFunc("GET /jobs/{id}/events", s.handleEvents)
+	mux.HandleFunc("GET /jobs/{id}/{result}", s.handleResult)
+	return mux
+}
+
+func (s *server) runJobs(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-s.queue:
+			s.runJob(ctx, j)
+		}
+	}
+}
+
+func (s *server) runJob(ctx context.Context, j *job) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	id := j.status.ID
+	j.mu.Lock()
+	if j.status.State == jobCanceled {
+		j.mu.Unlock()
+		return
+	}
+	j.cancel = cancel
+	j.status.State = jobRunning
+	j.notifyLocked()
+	j.mu.Unlock()
+	slog.InfoContext(ctx, "running job", slog.String("id", id))
+
+	model := primitive.NewModel(j.input, j.bg, j.size, s.workers)
+	model.Limiter = s.limiter
+	err := model.Run(ctx, j.stages, func(p primitive.Progress) error {
+		j.update(func(st *jobStatus) {
+			st.Frame = p.Frame
+			st.Score = p.Score
+			st.Elapsed = p.Elapsed.Seconds()
+		})
+		return nil
+	})
+	j.mu.Lock()
+	j.shapes = model.ShapeFile()
+	j.input = nil
+	j.mu.Unlock()
+	j.update(func(st *jobStatus) {
+		switch {
+		case err == nil:
+			st.State = jobDone
+		case errors.Is(err, context.Canceled):
+			st.State = jobCanceled
+		default:
+			st.State = jobFailed
+			st.Error = err.Error()
+		}
+	})
+	st, _ := j.snapshot()
+	slog.InfoContext(ctx, "finished job", slog.String("id", id), slog.String("state", string(st.State)))
+	s.expire()
+}
+
+// expire forgets the oldest finished jobs beyond the history limit.
+func (s *server) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	finished := 0
+	for i := len(s.order) - 1; i >= 0; i-- {
+		id := s.order[i]
+		st, _ := s.jobs[id].snapshot()
+		if !st.State.finished() {
+			continue
+		}
+		finished++
+		if finished > s.history {
+			delete(s.jobs, id)
+			s.order = append(s.order[:i], s.order[i+1:]...)
+		}
+	}
+}
+
+func (s *server) lookup(w http.ResponseWriter, r *http.Request) *job {
+	s.mu.Lock()
+	j, ok := s.jobs[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return nil
+	}
+	return j
+}
+
+func (s *server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	j, err := newJob(r, s.limits)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	select {
+	case s.queue <- j:
+		s.jobs[j.status.ID] = j
+		s.order = append(s.order, j.status.ID)
+		s.mu.Unlock()
+	default:
+		s.mu.Unlock()
+		http.Error(w, "job queue is full", http.StatusServiceUnavailable)
+		return
+	}
+	slog.InfoContext(r.Context(), "queued job", slog.String("id", j.status.ID))
+	st, _ := j.snapshot()
+	w.Header().Set("Location", "/jobs/"+st.ID)
+	writeJSON(w, http.StatusAccepted, st)
+}
+
+// newJob reads the uploaded image and parameters. Parameters share their
+// names and defaults with the command line flags, and are bounded by limits.
+func newJob(r *http.Request, limits jobLimits) (*job, error) {
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		return nil, fmt.Errorf("image: %w", err)
+	}
+	defer file.Close()
+	input, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("image: %w", err)
+	}
+	param := func(name string, def int) (int, error) {
+		value := r.FormValue(name)
+		if value == "" {
+			return def, nil
+		}
+		n, atoiErr := strconv.Atoi(value)
+		if atoiErr != nil {
+			return 0, fmt.Errorf("%s: %w", name, atoiErr)
+		}
+		return n, nil
+	}
+	var errs []error
+	count, err := param("n", 0)
+	errs = append(errs, err)
+	mode, err := param("m", 1)
+	errs = append(errs, err)
+	alpha, err := param("a", 128)
+	errs = append(errs, err)
+	repeat, err := param("rep", 0)
+	errs = append(errs, err)
+	inputSize, err := param("r", 256)
+	errs = append(errs, err)
+	size, err := param("s", 1024)
+	errs = append(errs, err)
+	if err = errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	if count < 1 || count > limits.count {
+		return nil, fmt.Errorf("n: number of primitives must be between 1 and %d", limits.count)
+	}
+	if mode < 0 || mode > int(primitive.ShapeTypeStar) {
+		return nil, fmt.Errorf("m: mode must be between 0 and %d", int(primitive.ShapeTypeStar))
+	}
+	if t := primitive.ShapeType(mode); t == primitive.ShapeTypeGlyph || t == primitive.ShapeTypeStamp {
+		return nil, errors.New("m: glyph and stamp modes are not supported by the server")
+	}
+	if alpha < 0 || alpha > 255 {
+		return nil, errors.New("a: alpha must be between 0 and 255")
+	}
+	if size < 1 || size > limits.size {
+		return nil, fmt.Errorf("s: output size must be between 1 and %d", limits.size)
+	}
+	if inputSize < 1 || inputSize > limits.inputSize {
+		return nil, fmt.Errorf("r: input size must be between 1 and %d", limits.inputSize)
+	}
+	if repeat < 0 || repeat > limits.repeat {
+		return nil, fmt.Errorf("rep: repeat count must be between 0 and %d", limits.repeat)
+	}
+	input = resize.Thumbnail(uint(inputSize), uint(inputSize), input, resize.Bilinear)
+	bg, err := backgroundColor(input, r.FormValue("bg"))
+	if err != nil {
+		return nil, fmt.Errorf("bg: %w", err)
+	}
+
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	stage := primitive.Stage{
+		Count:     count,
+		ShapeType: primitive.ShapeType(mode),
+		Alpha:     alpha,
+		AlphaEnd:  0,
+		Repeat:    repeat,
+		Tiles:     0,
+	}
+	return &job{
+		input:   input,
+		bg:      bg,
+		cancel:  nil,
+		shapes:  nil,
+		updated: make(chan struct{}),
+		stages:  []primitive.Stage{stage},
+		size:    size,
+		mu:      sync.Mutex{},
+		status: jobStatus{
+			ID:      hex.EncodeToString(id[:]),
+			State:   jobQueued,
+			Error:   "",
+			Frame:   0,
+			Frames:  count,
+			Score:   0,
+			Elapsed: 0,
+		},
+	}, nil
+}
+
+func (s *server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	j := s.lookup(w, r)
+	if j == nil {
+		return
+	}
+	st, _ := j.snapshot()
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (s *server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	j := s.lookup(w, r)
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	cancel := j.cancel
+	if cancel == nil && j.status.State == jobQueued {
+		j.status.State = jobCanceled
+		j.notifyLocked()
+	}
+	j.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	st, _ := j.snapshot()
+	writeJSON(w, http.StatusOK, st)
+}
+
+// handleEvents streams the job status as Server-Sent Events until the job
+// finishes or the client goes away.
+func (s *server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	j := s.lookup(w, r)
+	if j == nil {
+		return
+	}
+	sse, err := newEventStream(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for {
+		st, updated := j.snapshot()
+		event := "progress"
+		if st.State.finished() {
+			event = string(st.State)
+		}
+		if err := sse.Send(event, st); err != nil {
+			return
+		}
+		if st.State.finished() {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-updated:
+		}
+	}
+}
+
+func (s *server) handleResult(w http.ResponseWriter, r *http.Request) {
+	j := s.lookup(w, r)
+	if j == nil {
+		return
+	}
+	name := r.PathValue("result")
+	if name != "result.png" && name != "result.svg" && name != "result.json" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	st, _ := j.snapshot()
+	j.mu.Lock()
+	shapes := j.shapes
+	j.mu.Unlock()
+	if st.State != jobDone || shapes == nil {
+		http.Error(w, fmt.Sprintf("job is %s", st.State), http.StatusConflict)
+		return
+	}
+	if name == "result.json" {
+		b, err := json.MarshalIndent(shapes, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(b); err != nil {
+			slog.ErrorContext(r.Context(), "writing result", slog.String("error", err.Error()))
+		}
+		return
+	}
+	// finished jobs keep only their shapes, so images are replayed from them
+	model, err := shapes.Model(j.size, primitive.DefaultShapeOptions())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	switch name {
+	case "result.png":
+		w.Header().Set("Content-Type", "image/png")
+		if err := png.Encode(w, model.Context.Image()); err != nil {
+			slog.ErrorContext(r.Context(), "writing result", slog.String("error", err.Error()))
+		}
+	case "result.svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		if _, err := fmt.Fprint(w, model.SVG()); err != nil {
+			slog.ErrorContext(r.Context(), "writing result", slog.String("error", err.Error()))
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("writing response", slog.String("error", err.Error()))
+	}
+}
+
+type eventStream struct {
+	w http.ResponseWriter
+	f http.Flusher
+}
+
+func newEventStream(w http.ResponseWriter) (*eventStream, error) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming unsupported")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+	return &eventStream{w: w, f: f}, nil
+}
+
+// Send writes one event with v encoded as JSON data.
+func (s *eventStream) Send(event string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, b); err != nil {
+		return err
+	}
+	s.f.Flush()
+	return nil
+}